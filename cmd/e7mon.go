@@ -75,13 +75,11 @@ func Execute() {
 							},
 						},
 						Action: func(c *cli.Context) error {
-							// TODO: only works with Geth, Erigon does not have `admin` namespace.
-							// Need some way to check if admin namespace is enabled
 							mon := monitor.NewExecutionMonitor()
-							i := c.String("interface")
+							if err := mon.P2PStat(c.String("interface")); err != nil {
+								log.Fatal().Err(err).Msg("")
+							}
 
-							_ = mon
-							_ = i
 							return nil
 						},
 					},
@@ -117,7 +115,18 @@ func Execute() {
 								log.Fatal().Err(err).Msg("")
 							}
 
-							log.Info().Str("high", res.High.String()).Str("low", res.Low.String()).Str("avg", res.Average.String()).Str("response_rate", fmt.Sprintf("%.2f%%", float64(res.Responses)/float64(res.Connected)*100)).Msg("[P2P] Latency scan results")
+							monitor.LogLatency(log, res)
+
+							return nil
+						},
+					},
+					{
+						Name:  "peers",
+						Usage: "prints the connected peers, their clients and directions",
+						Action: func(c *cli.Context) error {
+							if err := monitor.NewBeaconMonitor().PrintPeers(); err != nil {
+								log.Fatal().Err(err).Msg("")
+							}
 
 							return nil
 						},
@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -20,11 +22,35 @@ type Config struct {
 	ValidatorConfig *ValidatorConfig `yaml:"validator"`
 	StatsConfig     []Stat           `yaml:"stats"`
 	NetConfig       *NetConfig       `yaml:"net"`
+	MetricsConfig   *MetricsConfig   `yaml:"metrics"`
+	AlertsConfig    *AlertsConfig    `yaml:"alerts"`
 }
 
 type ExecutionConfig struct {
-	API      string   `yaml:"api"`
-	Settings Settings `yaml:"settings"`
+	API string `yaml:"api"`
+	// Trusted node to compare our head with
+	ReferenceAPI string        `yaml:"reference_api,omitempty"`
+	Engine       *EngineConfig `yaml:"engine,omitempty"`
+	MEV          *MEVConfig    `yaml:"mev,omitempty"`
+	Settings     Settings      `yaml:"settings"`
+}
+
+// EngineConfig is the authenticated Engine API the beacon node talks to.
+type EngineConfig struct {
+	URL string `yaml:"url"`
+	// Path to the hex encoded secret (jwt.hex) shared with the beacon node
+	JWTSecret string        `yaml:"jwt_secret"`
+	Interval  time.Duration `yaml:"interval,omitempty"`
+}
+
+// MEVConfig enables the MEV analysis of the head blocks.
+type MEVConfig struct {
+	// Our fee recipients, the MEV of blocks paying to these is reported
+	FeeRecipients []string `yaml:"fee_recipients"`
+	// Flag blocks that pay at least this many ETH directly to their fee recipient
+	CoinbaseThreshold float64 `yaml:"coinbase_threshold,omitempty"`
+	// MEV-boost relays, to verify the payment for the payloads they delivered to us
+	Relays []string `yaml:"relays,omitempty"`
 }
 
 type BeaconConfig struct {
@@ -33,14 +59,30 @@ type BeaconConfig struct {
 }
 
 type ValidatorConfig struct {
-	ID       string   `yaml:"id"`
-	Index    uint64   `yaml:"index"`
-	Settings Settings `yaml:"settings"`
+	// Single validator by public key or index, use Validators for more
+	ID string `yaml:"id"`
+	// Pointer so index 0 can be told apart from unset
+	Index *uint64 `yaml:"index"`
+	// Validator indices and/or BLS public keys
+	Validators []string `yaml:"validators"`
+	// File with one validator index or public key per line
+	ValidatorsFile string `yaml:"validators_file"`
+	// Consecutive missed sync committee signatures before alerting
+	SyncCommitteeMisses int      `yaml:"sync_committee_misses"`
+	Settings            Settings `yaml:"settings"`
 }
 
 type Settings struct {
-	BlockTimeLevels []string     `yaml:"block_time_levels"`
-	StatsConfig     *StatsConfig `yaml:"stats"`
+	BlockTimeLevels []string `yaml:"block_time_levels"`
+	// Beacon only
+	FinalityLagLevels []uint64 `yaml:"finality_lag_levels,omitempty"`
+	ReorgDepthLevels  []uint64 `yaml:"reorg_depth_levels,omitempty"`
+	// Execution only
+	MaxHeadLag      uint64 `yaml:"max_head_lag,omitempty"`
+	ReorgAlertDepth uint64 `yaml:"reorg_alert_depth,omitempty"`
+	// How often to poll for new blocks if the API isn't a websocket
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+	StatsConfig  *StatsConfig  `yaml:"stats"`
 }
 
 type StatsConfig struct {
@@ -51,6 +93,9 @@ type StatsConfig struct {
 type Stat struct {
 	ID      string `yaml:"id"`
 	Latency bool   `yaml:"latency,omitempty"`
+	// Number of latency scans to keep per peer, and the number of slowest peers to list
+	LatencyWindow int `yaml:"latency_window,omitempty"`
+	SlowestPeers  int `yaml:"slowest_peers,omitempty"`
 }
 
 type NetConfig struct {
@@ -58,6 +103,67 @@ type NetConfig struct {
 	Backup    string `yaml:"backup,omitempty"`
 }
 
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+	Path    string `yaml:"path"`
+}
+
+type AlertsConfig struct {
+	Channels []Channel `yaml:"channels"`
+	// Routes maps an alert level (info, warning, critical) to channel IDs
+	Routes map[string][]string `yaml:"routes"`
+}
+
+type Channel struct {
+	ID   string `yaml:"id"`
+	Type string `yaml:"type"`
+	// Webhook URL for webhook, slack and discord channels. Overrides the API URL for telegram.
+	URL string `yaml:"url,omitempty"`
+	// Telegram
+	Token  string `yaml:"token,omitempty"`
+	ChatID string `yaml:"chat_id,omitempty"`
+	// SMTP
+	Host     string   `yaml:"host,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+}
+
+// Identifiers returns all the configured validator indices and public keys.
+func (c *ValidatorConfig) Identifiers() ([]string, error) {
+	var ids []string
+	if c.ID != "" {
+		ids = append(ids, c.ID)
+	}
+
+	if c.Index != nil {
+		ids = append(ids, strconv.FormatUint(*c.Index, 10))
+	}
+
+	ids = append(ids, c.Validators...)
+
+	if c.ValidatorsFile != "" {
+		data, err := os.ReadFile(c.ValidatorsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading validators file: %w", err)
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			// Skip empty lines and comments
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			ids = append(ids, line)
+		}
+	}
+
+	return ids, nil
+}
+
 func NewConfig() (*Config, error) {
 	c := Config{}
 	configPath, err := os.UserConfigDir()
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestIdentifiers(t *testing.T) {
+	file := path.Join(t.TempDir(), "validators.txt")
+	err := os.WriteFile(file, []byte("# our keys\n1337\n\n  0xa99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c  \n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := uint64(42069)
+	c := ValidatorConfig{
+		Index:          &index,
+		Validators:     []string{"1", "2"},
+		ValidatorsFile: file,
+	}
+
+	ids, err := c.Identifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"42069", "1", "2", "1337", "0xa99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	// Index 0 is a valid validator
+	c = ValidatorConfig{}
+	if err := yaml.Unmarshal([]byte("index: 0\n"), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err = c.Identifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ids, []string{"0"}) {
+		t.Errorf("expected [0], got %v", ids)
+	}
+
+	// Not set
+	ids, _ = (&ValidatorConfig{}).Identifiers()
+	if len(ids) != 0 {
+		t.Errorf("expected no identifiers, got %v", ids)
+	}
+}
@@ -11,6 +11,7 @@ require (
 	github.com/go-stack/stack v1.8.1 // indirect
 	github.com/google/gopacket v1.1.19
 	github.com/mdlayher/arp v0.0.0-20191213142603-f72070a231fc
+	github.com/prometheus/client_golang v1.11.0
 	github.com/rs/zerolog v1.25.0
 	github.com/tidwall/gjson v1.9.4
 	github.com/tklauser/go-sysconf v0.3.9 // indirect
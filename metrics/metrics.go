@@ -0,0 +1,441 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/netbound/e7mon/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "e7mon"
+
+// blockClock keeps track of the time the last block was received, so the
+// "seconds since last block" gauges can be computed at scrape time.
+type blockClock struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Tick registers a new block and returns the time since the previous one.
+func (c *blockClock) Tick() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var dur time.Duration
+	now := time.Now()
+	if !c.last.IsZero() {
+		dur = now.Sub(c.last)
+	}
+	c.last = now
+
+	return dur
+}
+
+func (c *blockClock) Since() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last.IsZero() {
+		return 0
+	}
+
+	return time.Since(c.last).Seconds()
+}
+
+var (
+	executionClock = &blockClock{}
+	beaconClock    = &blockClock{}
+
+	// Block intervals on mainnet are 12s, the buckets should be able to tell
+	// a missed slot from a stalled chain.
+	blockIntervalBuckets = []float64{1, 6, 12, 18, 24, 36, 48, 60, 120, 300}
+)
+
+// Execution client metrics
+var (
+	ExecutionHead = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "head_block",
+		Help:      "Number of the latest execution block.",
+	})
+
+	ExecutionBlockInterval = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "block_interval_seconds",
+		Help:      "Time between consecutive execution blocks.",
+		Buckets:   blockIntervalBuckets,
+	})
+
+	ExecutionPeers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "peers",
+		Help:      "Number of peers connected to the execution client.",
+	})
+
+	ExecutionGasUtilisation = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "gas_utilisation_ratio",
+		Help:      "Gas used divided by the gas limit of the latest execution block.",
+	})
+
+	ExecutionBaseFee = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "base_fee_gwei",
+		Help:      "Base fee of the latest execution block in Gwei.",
+	})
+
+	ExecutionTransactions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "block_transactions",
+		Help:      "Number of transactions in the latest execution block.",
+	})
+
+	ExecutionReorgs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "reorgs_total",
+		Help:      "Number of execution chain reorgs.",
+	})
+
+	ExecutionReorgDepth = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "reorg_depth",
+		Help:      "Depth of the execution chain reorgs in blocks.",
+		Buckets:   []float64{1, 2, 3, 4, 8, 16, 32, 64},
+	})
+
+	ExecutionPriorityFees = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "priority_fees_eth",
+		Help:      "Priority fees paid to the fee recipient of the latest analysed block.",
+	})
+
+	ExecutionCoinbaseTransfers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "coinbase_transfers_eth",
+		Help:      "Value sent directly to the fee recipient of the latest analysed block.",
+	})
+
+	ExecutionSandwiches = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "sandwiches_total",
+		Help:      "Number of sandwiches found in the analysed blocks.",
+	})
+
+	RelayPayloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "relay_payloads_total",
+		Help:      "Our blocks by relay payload verification result (verified, mismatch, local).",
+	}, []string{"result"})
+
+	EngineUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "up",
+		Help:      "Whether the Engine API is reachable and accepts our JWT (1) or not (0).",
+	})
+
+	EngineLatency = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "latency_seconds",
+		Help:      "Round trip time of the last Engine API request.",
+	})
+
+	ExecutionTxPool = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "txpool_transactions",
+		Help:      "Number of transactions in the transaction pool by state.",
+	}, []string{"state"})
+
+	ExecutionPendingTxRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "pending_transactions_per_second",
+		Help:      "Rate of new pending transactions, if txpool_status isn't available.",
+	})
+
+	ExecutionSyncing = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "syncing",
+		Help:      "Whether the execution client is syncing (1) or not (0).",
+	})
+
+	ExecutionSyncRemaining = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "sync_remaining_blocks",
+		Help:      "Number of blocks the execution client still has to sync.",
+	})
+
+	ExecutionHeadLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "head_lag_blocks",
+		Help:      "Number of blocks our head trails the reference node.",
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "execution",
+		Name:      "seconds_since_last_block",
+		Help:      "Seconds since the last execution block was received.",
+	}, executionClock.Since)
+)
+
+// Beacon node metrics
+var (
+	BeaconSlot = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "head_slot",
+		Help:      "Slot of the latest beacon block.",
+	})
+
+	BeaconEpoch = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "head_epoch",
+		Help:      "Epoch of the latest beacon block.",
+	})
+
+	BeaconBlockInterval = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "block_interval_seconds",
+		Help:      "Time between consecutive beacon blocks.",
+		Buckets:   blockIntervalBuckets,
+	})
+
+	BeaconBlockDelay = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "block_delay_seconds",
+		Help:      "Time into the slot at which the beacon block arrived.",
+		Buckets:   []float64{.5, 1, 2, 3, 4, 6, 8, 12},
+	})
+
+	// A gauge, slots are no longer empty if their block arrives late
+	BeaconEmptySlots = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "empty_slots",
+		Help:      "Number of slots without a beacon block, late blocks are subtracted.",
+	})
+
+	BeaconSyncDistance = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "sync_distance",
+		Help:      "Number of slots the head of the beacon node is behind.",
+	})
+
+	BeaconOptimistic = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "optimistic",
+		Help:      "Whether the head of the beacon node is optimistic (1) or not (0).",
+	})
+
+	BeaconELOffline = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "el_offline",
+		Help:      "Whether the beacon node reports its execution client offline (1) or not (0).",
+	})
+
+	BeaconPeerDirection = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "peers_direction",
+		Help:      "Number of connected beacon node peers by direction.",
+	}, []string{"direction"})
+
+	BeaconPeerClients = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "peers_client",
+		Help:      "Number of connected beacon node peers by consensus client.",
+	}, []string{"client"})
+
+	BeaconPeerChurn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "peers_churn_total",
+		Help:      "Number of beacon node peers added and dropped.",
+	}, []string{"change"})
+
+	BeaconReorgs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "reorgs_total",
+		Help:      "Number of beacon chain reorgs.",
+	})
+
+	BeaconReorgDepth = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "reorg_depth",
+		Help:      "Depth of the beacon chain reorgs in slots.",
+		Buckets:   []float64{1, 2, 3, 4, 8, 16, 32},
+	})
+
+	BeaconFinalizedEpoch = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "finalized_epoch",
+		Help:      "Epoch of the latest finalized checkpoint.",
+	})
+
+	BeaconJustifiedEpoch = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "justified_epoch",
+		Help:      "Epoch of the current justified checkpoint.",
+	})
+
+	BeaconFinalityLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "finality_lag_epochs",
+		Help:      "Number of epochs the finalized checkpoint lags behind the current epoch.",
+	})
+
+	BeaconPeers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "peers",
+		Help:      "Number of beacon node peers by connection state.",
+	}, []string{"state"})
+
+	BeaconLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "p2p_latency_seconds",
+		Help:      "Result of the last latency scan (high, low and average).",
+	}, []string{"stat"})
+
+	BeaconLatencyResponseRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "p2p_latency_response_rate",
+		Help:      "Fraction of connected peers that responded to the last latency scan.",
+	})
+
+	BeaconPeerLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "p2p_peer_latency_seconds",
+		Help:      "Latency of the individual peers measured by latency scans.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .15, .2, .3, .5, 1},
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "beacon",
+		Name:      "seconds_since_last_block",
+		Help:      "Seconds since the last beacon block was received.",
+	}, beaconClock.Since)
+)
+
+// Validator metrics
+var (
+	ValidatorBalance = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "balance_gwei",
+		Help:      "Balance of the validator in Gwei.",
+	}, []string{"index"})
+
+	ValidatorAttestations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "attestations_total",
+		Help:      "Attestation duties by result (included, missed).",
+	}, []string{"index", "result"})
+
+	ValidatorInclusionDistance = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "attestation_inclusion_distance",
+		Help:      "Distance in slots between the attestation slot and the slot it was included in.",
+		Buckets:   []float64{1, 2, 3, 4, 8, 16, 32},
+	})
+
+	ValidatorSyncSignatures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "sync_committee_signatures_total",
+		Help:      "Sync committee signatures by result (included, missed).",
+	}, []string{"index", "result"})
+
+	ValidatorEpochRewards = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "validator",
+		Name:      "epoch_rewards_gwei",
+		Help:      "Rewards of all validators in the last accounted epoch by component (total, attestation, proposal, sync_committee).",
+	}, []string{"component"})
+)
+
+// ExecutionBlock records a new execution block.
+func ExecutionBlock(number int64) {
+	ExecutionHead.Set(float64(number))
+	if dur := executionClock.Tick(); dur > 0 {
+		ExecutionBlockInterval.Observe(dur.Seconds())
+	}
+}
+
+// BeaconBlock records a new beacon block.
+func BeaconBlock(slot, epoch uint64) {
+	BeaconSlot.Set(float64(slot))
+	BeaconEpoch.Set(float64(epoch))
+	if dur := beaconClock.Tick(); dur > 0 {
+		BeaconBlockInterval.Observe(dur.Seconds())
+	}
+}
+
+var once sync.Once
+
+// Serve starts the HTTP metrics endpoint if it's enabled in the config. It's safe
+// to call this from every monitor, the server will only be started once.
+func Serve(cfg *config.MetricsConfig) {
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	once.Do(func() {
+		path := cfg.Path
+		if path == "" {
+			path = "/metrics"
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(path, promhttp.Handler())
+
+		go func() {
+			log.Info().Str("address", cfg.Address).Str("path", path).Msg("Serving metrics")
+			if err := http.ListenAndServe(cfg.Address, mux); err != nil {
+				log.Error().Err(err).Msg("Metrics server stopped")
+			}
+		}()
+	})
+}
@@ -0,0 +1,426 @@
+package monitor
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	api "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/tidwall/gjson"
+)
+
+// attestationSummary aggregates the attestation results of our validators for one epoch.
+type attestationSummary struct {
+	Duties   int
+	Included int
+	Distance uint64
+
+	Missed      []phase0.ValidatorIndex
+	WrongSource []phase0.ValidatorIndex
+	WrongHead   []phase0.ValidatorIndex
+	WrongTarget []phase0.ValidatorIndex
+}
+
+func (s *attestationSummary) Done() bool {
+	return s.Included+len(s.Missed) >= s.Duties
+}
+
+// updateAttesterDuties adds the attester duties of epoch that haven't been scanned yet.
+func (vm *ValidatorMonitor) updateAttesterDuties(epoch phase0.Epoch, scanned phase0.Slot) error {
+	duties, err := vm.getAttesterDuties(epoch)
+	if err != nil {
+		return err
+	}
+
+	summary := &attestationSummary{}
+	for _, duty := range duties {
+		if duty.Slot >= scanned {
+			vm.attesterDuties = append(vm.attesterDuties, duty)
+			summary.Duties++
+		}
+	}
+
+	if summary.Duties > 0 {
+		vm.attestations[epoch] = summary
+	}
+
+	return nil
+}
+
+// expireAttestations flags the attestations that can't be included anymore as missed.
+func (vm *ValidatorMonitor) expireAttestations(scanned phase0.Slot) {
+	remaining := vm.attesterDuties[:0]
+	for _, duty := range vm.attesterDuties {
+		if scanned >= vm.spec.InclusionDeadline(duty.Slot) {
+			metrics.ValidatorAttestations.WithLabelValues(fmt.Sprint(duty.ValidatorIndex), "missed").Inc()
+
+			epoch := vm.spec.Epoch(duty.Slot)
+			if s, ok := vm.attestations[epoch]; ok {
+				s.Missed = append(s.Missed, duty.ValidatorIndex)
+				vm.reportAttestations(epoch)
+			}
+			continue
+		}
+
+		remaining = append(remaining, duty)
+	}
+	vm.attesterDuties = remaining
+
+	// The roots and committees are only needed for the attestations we're still waiting on
+	for slot := range vm.roots {
+		if uint64(slot)+2*vm.spec.SlotsPerEpoch < uint64(scanned) {
+			delete(vm.roots, slot)
+		}
+	}
+
+	for epoch := range vm.justified {
+		if vm.spec.EpochStart(epoch+2) < scanned {
+			delete(vm.justified, epoch)
+		}
+	}
+
+	for slot := range vm.committees {
+		if scanned > vm.spec.InclusionDeadline(slot) {
+			delete(vm.committees, slot)
+		}
+	}
+}
+
+// attestation is an included attestation. Since Electra an aggregate can span multiple
+// committees, the aggregation bits of the committees in CommitteeBits are concatenated.
+type attestation struct {
+	*phase0.Attestation
+	// Nil before Electra
+	CommitteeBits []byte
+}
+
+// decodeAttestations decodes the attestations in the block according to the fork at slot.
+func (vm *ValidatorMonitor) decodeAttestations(block gjson.Result, slot phase0.Slot) ([]*attestation, error) {
+	electra := vm.spec.Active(ForkElectra, vm.spec.Epoch(slot))
+
+	var attestations []*attestation
+	for _, raw := range block.Get("body.attestations").Array() {
+		att := &attestation{Attestation: &phase0.Attestation{}}
+		if err := json.Unmarshal([]byte(raw.Raw), att.Attestation); err != nil {
+			return nil, err
+		}
+
+		if electra {
+			bits, err := hex.DecodeString(strings.TrimPrefix(raw.Get("committee_bits").String(), "0x"))
+			if err != nil {
+				return nil, err
+			}
+			att.CommitteeBits = bits
+		}
+
+		attestations = append(attestations, att)
+	}
+
+	return attestations, nil
+}
+
+// checkInclusions looks for our attestations in the block at slot.
+func (vm *ValidatorMonitor) checkInclusions(block gjson.Result, slot phase0.Slot) error {
+	attestations, err := vm.decodeAttestations(block, slot)
+	if err != nil {
+		return err
+	}
+
+	remaining := vm.attesterDuties[:0]
+	for _, duty := range vm.attesterDuties {
+		if duty.Slot >= slot {
+			remaining = append(remaining, duty)
+			continue
+		}
+
+		var included *attestation
+		for _, att := range attestations {
+			ok, err := vm.covers(att, duty)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				included = att
+				break
+			}
+		}
+
+		if included == nil {
+			remaining = append(remaining, duty)
+			continue
+		}
+
+		vm.checkAttestation(duty, included.Attestation, slot)
+	}
+	vm.attesterDuties = remaining
+
+	return nil
+}
+
+// covers reports if the attestation includes the vote of the validator with duty.
+func (vm *ValidatorMonitor) covers(att *attestation, duty *api.AttesterDuty) (bool, error) {
+	if att.Data.Slot != duty.Slot {
+		return false, nil
+	}
+
+	if att.CommitteeBits == nil {
+		return att.Data.Index == duty.CommitteeIndex && att.AggregationBits.BitAt(duty.ValidatorCommitteeIndex), nil
+	}
+
+	if !bitAt(att.CommitteeBits, uint64(duty.CommitteeIndex)) {
+		return false, nil
+	}
+
+	sizes, err := vm.committeeSizes(duty.Slot)
+	if err != nil {
+		return false, err
+	}
+
+	// Offset of our committee in the aggregation bits
+	var offset uint64
+	for c := phase0.CommitteeIndex(0); c < duty.CommitteeIndex; c++ {
+		if bitAt(att.CommitteeBits, uint64(c)) {
+			offset += sizes[c]
+		}
+	}
+
+	return att.AggregationBits.BitAt(offset + duty.ValidatorCommitteeIndex), nil
+}
+
+// committeeSizes returns the sizes of the committees at slot.
+func (vm *ValidatorMonitor) committeeSizes(slot phase0.Slot) (map[phase0.CommitteeIndex]uint64, error) {
+	if sizes, ok := vm.committees[slot]; ok {
+		return sizes, nil
+	}
+
+	body, err := getJSON(fmt.Sprintf("%s/eth/v1/beacon/states/head/committees?slot=%d", vm.API, slot))
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[phase0.CommitteeIndex]uint64)
+	for _, c := range gjson.GetBytes(body, "data").Array() {
+		sizes[phase0.CommitteeIndex(c.Get("index").Uint())] = uint64(len(c.Get("validators").Array()))
+	}
+	vm.committees[slot] = sizes
+
+	return sizes, nil
+}
+
+// bitAt returns bit i of a bitvector.
+func bitAt(bits []byte, i uint64) bool {
+	return i/8 < uint64(len(bits)) && bits[i/8]&(1<<(i%8)) != 0
+}
+
+// justifiedCheckpoint returns the justified checkpoint the attestations of epoch vote for
+// as their source, from the state at slot in that epoch.
+func (vm *ValidatorMonitor) justifiedCheckpoint(epoch phase0.Epoch, slot phase0.Slot) (*phase0.Checkpoint, error) {
+	if cp, ok := vm.justified[epoch]; ok {
+		return cp, nil
+	}
+
+	body, err := getJSON(fmt.Sprintf("%s/eth/v1/beacon/states/%d/finality_checkpoints", vm.API, slot))
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return nil, fmt.Errorf("state at slot %d not found", slot)
+	}
+
+	data := gjson.GetBytes(body, "data.current_justified")
+	root, err := parseRoot(data.Get("root").String())
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &phase0.Checkpoint{Epoch: phase0.Epoch(data.Get("epoch").Uint()), Root: root}
+	vm.justified[epoch] = cp
+
+	return cp, nil
+}
+
+// checkAttestation checks the source, target and head votes of an included attestation.
+func (vm *ValidatorMonitor) checkAttestation(duty *api.AttesterDuty, att *phase0.Attestation, slot phase0.Slot) {
+	log := vm.Logger
+
+	distance := uint64(slot - duty.Slot)
+
+	// Blocks with a wrong source are invalid, so assume it's correct if the state is gone
+	source := true
+	justified, err := vm.justifiedCheckpoint(vm.spec.Epoch(duty.Slot), duty.Slot)
+	if err != nil {
+		log.Debug().Err(err).Msg("Error getting justified checkpoint")
+	} else {
+		source = justified.Epoch == att.Data.Source.Epoch && justified.Root == att.Data.Source.Root
+	}
+
+	target := false
+	targetRoot, err := vm.blockRootAt(vm.spec.EpochStart(att.Data.Target.Epoch))
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting target root")
+	} else {
+		target = targetRoot == att.Data.Target.Root
+	}
+
+	head := false
+	headRoot, err := vm.blockRootAt(duty.Slot)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting head root")
+	} else {
+		head = headRoot == att.Data.BeaconBlockRoot
+	}
+
+	metrics.ValidatorAttestations.WithLabelValues(fmt.Sprint(duty.ValidatorIndex), "included").Inc()
+	metrics.ValidatorInclusionDistance.Observe(float64(distance))
+
+	log.Info().Uint64("validator_index", uint64(duty.ValidatorIndex)).
+		Uint64("slot", uint64(duty.Slot)).
+		Uint64("inclusion_slot", uint64(slot)).
+		Uint64("distance", distance).
+		Bool("source", source).
+		Bool("target", target).
+		Bool("head", head).
+		Msg("Attestation included")
+
+	epoch := vm.spec.Epoch(duty.Slot)
+	s, ok := vm.attestations[epoch]
+	if !ok {
+		return
+	}
+
+	s.Included++
+	s.Distance += distance
+	if !source {
+		s.WrongSource = append(s.WrongSource, duty.ValidatorIndex)
+	}
+	if !head {
+		s.WrongHead = append(s.WrongHead, duty.ValidatorIndex)
+	}
+	if !target {
+		s.WrongTarget = append(s.WrongTarget, duty.ValidatorIndex)
+	}
+
+	vm.reportAttestations(epoch)
+}
+
+// reportAttestations logs the summary of epoch once all its attestations are included or missed,
+// followed by the validators that didn't perform.
+func (vm *ValidatorMonitor) reportAttestations(epoch phase0.Epoch) {
+	log := vm.Logger
+
+	s := vm.attestations[epoch]
+	if !s.Done() {
+		return
+	}
+	delete(vm.attestations, epoch)
+
+	avg := 0.0
+	if s.Included > 0 {
+		avg = float64(s.Distance) / float64(s.Included)
+	}
+
+	log.Info().Uint64("epoch", uint64(epoch)).
+		Int("duties", s.Duties).
+		Int("included", s.Included).
+		Int("missed", len(s.Missed)).
+		Str("avg_distance", fmt.Sprintf("%.2f", avg)).
+		Int("wrong_source", len(s.WrongSource)).
+		Int("wrong_head", len(s.WrongHead)).
+		Int("wrong_target", len(s.WrongTarget)).
+		Msg("Attestations")
+
+	if len(s.Missed) > 0 {
+		log.Warn().Uint64("epoch", uint64(epoch)).Uints64("validators", uint64s(s.Missed)).Msg("Missed attestations")
+		sendAlert(vm.Notifier, log, notify.Alert{
+			Level:   notify.Warning,
+			Source:  SourceValidator,
+			Message: fmt.Sprintf("%d of %d validators missed their attestation in epoch %d", len(s.Missed), s.Duties, epoch),
+		})
+	}
+
+	if len(s.WrongSource) > 0 {
+		log.Warn().Uint64("epoch", uint64(epoch)).Uints64("validators", uint64s(s.WrongSource)).Msg("Incorrect source votes")
+	}
+
+	if len(s.WrongHead) > 0 {
+		log.Warn().Uint64("epoch", uint64(epoch)).Uints64("validators", uint64s(s.WrongHead)).Msg("Incorrect head votes")
+	}
+
+	if len(s.WrongTarget) > 0 {
+		log.Warn().Uint64("epoch", uint64(epoch)).Uints64("validators", uint64s(s.WrongTarget)).Msg("Incorrect target votes")
+	}
+}
+
+func (vm *ValidatorMonitor) getAttesterDuties(epoch phase0.Epoch) ([]*api.AttesterDuty, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return vm.Client.AttesterDuties(ctx, epoch, vm.Indices)
+}
+
+// block returns the message of the block at slot, found is false for missed slots. The block
+// is fetched as raw JSON so it works for every fork.
+func (vm *ValidatorMonitor) block(slot phase0.Slot) (block gjson.Result, found bool, err error) {
+	body, err := getJSON(vm.API + "/eth/v2/beacon/blocks/" + strconv.FormatUint(uint64(slot), 10))
+	if err != nil || body == nil {
+		return
+	}
+
+	return gjson.GetBytes(body, "data.message"), true, nil
+}
+
+// blockRootAt returns the root of the canonical block at slot, or the last block
+// before it if the slot was missed.
+func (vm *ValidatorMonitor) blockRootAt(slot phase0.Slot) (phase0.Root, error) {
+	if root, ok := vm.roots[slot]; ok {
+		return root, nil
+	}
+
+	for s := slot; uint64(s)+vm.spec.SlotsPerEpoch > uint64(slot); s-- {
+		body, err := getJSON(vm.API + "/eth/v1/beacon/headers/" + strconv.FormatUint(uint64(s), 10))
+		if err != nil {
+			return phase0.Root{}, err
+		}
+
+		if body != nil {
+			root, err := parseRoot(gjson.GetBytes(body, "data.root").String())
+			if err != nil {
+				return phase0.Root{}, err
+			}
+
+			vm.roots[slot] = root
+			return root, nil
+		}
+
+		if s == 0 {
+			break
+		}
+	}
+
+	return phase0.Root{}, fmt.Errorf("no block found in the epoch before slot %d", slot)
+}
+
+func parseRoot(s string) (phase0.Root, error) {
+	var root phase0.Root
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return root, err
+	}
+
+	if len(b) != len(root) {
+		return root, fmt.Errorf("invalid root length %d", len(b))
+	}
+	copy(root[:], b)
+
+	return root, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	gonet "net"
 	web "net/http"
 	"os"
 	"strconv"
@@ -12,28 +13,34 @@ import (
 	"time"
 
 	"github.com/netbound/e7mon/config"
-	"github.com/netbound/e7mon/net"
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
 
 	api "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/attestantio/go-eth2-client/http"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/fatih/color"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/tidwall/gjson"
 )
 
-const (
-	SLOTS_PER_EPOCH = 32
-)
-
 type BeaconMonitor struct {
 	Config        *config.BeaconConfig
 	Client        *http.Service
 	Stats         []config.Stat
+	Metrics       *config.MetricsConfig
 	Logger        zerolog.Logger
+	Notifier      *notify.Dispatcher
 	InterfaceName string
 	Reset         chan bool
-	Scanner       *net.Scanner
+
+	blockHandlers []func(*api.BlockEvent)
+	reorgHandlers []func(*ChainReorg)
+	latency       *latencyHistory
+	scanner       *scannerCache
+	spec          *Spec
+	slots         *slotTracker
 }
 
 func NewBeaconMonitor() *BeaconMonitor {
@@ -66,21 +73,27 @@ func NewBeaconMonitor() *BeaconMonitor {
 		logger.Fatal().Err(err).Msg("Can't connect to JSON-RPC API, is the endpoint correct and running?")
 	}
 
+	notifier, err := notify.New(cfg.AlertsConfig)
+	if err != nil {
+		logger.Fatal().Msg(err.Error())
+	}
+
 	return &BeaconMonitor{
 		Config:        cfg.BeaconConfig,
 		Logger:        log.Output(output),
+		Notifier:      notifier,
 		Stats:         cfg.StatsConfig,
+		Metrics:       cfg.MetricsConfig,
 		InterfaceName: cfg.NetConfig.Interface,
 		Client:        c,
+		latency:       newLatencyHistory(),
+		scanner:       &scannerCache{},
 	}
 }
 
 func (bm BeaconMonitor) Start() {
 	log := bm.Logger
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
 	reset := make(chan bool)
 	bm.Reset = reset
 
@@ -91,7 +104,21 @@ func (bm BeaconMonitor) Start() {
 
 	log.Info().Str("api", bm.Config.API).Str("node_version", ver).Msg("Starting beacon node monitor")
 
-	bm.subscribeToBlocks(ctx, []string{"block"}, bm.EventHandler)
+	metrics.Serve(bm.Metrics)
+
+	bm.spec, err = NewSpec(bm.Config.API)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error getting chain spec")
+	}
+
+	fork := bm.spec.ForkAt(bm.spec.CurrentEpoch())
+	log.Info().Str("network", bm.spec.Network()).Str("fork", fork.Name).Uint64("fork_epoch", uint64(fork.Epoch)).Msg("Detected network")
+	bm.slots = newSlotTracker()
+
+	bm.subscribeToEvents([]string{"block", "finalized_checkpoint", "chain_reorg"}, bm.EventHandler)
+
+	go bm.watchSlots()
+	go bm.watchFinality()
 
 	topics, err := parseTopics(bm.Stats, bm.Config.Settings.StatsConfig.Topics...)
 	if err != nil {
@@ -101,16 +128,26 @@ func (bm BeaconMonitor) Start() {
 	bm.statLoop(bm.Config.Settings.StatsConfig.Interval, topics)
 }
 
-var last time.Time = time.Time{}
-
-func (bm *BeaconMonitor) subscribeToBlocks(ctx context.Context, events []string, handler func(*api.Event)) {
+func (bm *BeaconMonitor) subscribeToEvents(events []string, handler func(*api.Event)) {
 	// For events: no ws necessary, this API uses server streamed events (SSE)
-	// https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events
 	go bm.startBlockTimer()
-	err := bm.Client.Events(ctx, events, handler)
-	if err != nil {
-		log.Fatal().Err(err).Msg("")
-	}
+	go supervisor{
+		Name:     "Beacon node",
+		Source:   SourceBeacon,
+		Logger:   bm.Logger,
+		Notifier: bm.Notifier,
+		// No block timer warnings while we know the connection is down
+		OnDown: func() { bm.Reset <- false },
+		OnUp:   func() { bm.Reset <- true },
+	}.Run(func(up func()) error {
+		return streamEvents(bm.Logger, bm.Config.API, events, handler, up)
+	})
+}
+
+// OnBlock registers a handler that is called for every block event. Has to be
+// called before starting the monitor.
+func (bm *BeaconMonitor) OnBlock(handler func(*api.BlockEvent)) {
+	bm.blockHandlers = append(bm.blockHandlers, handler)
 }
 
 func (bm BeaconMonitor) EventHandler(event *api.Event) {
@@ -119,28 +156,59 @@ func (bm BeaconMonitor) EventHandler(event *api.Event) {
 	switch event.Data.(type) {
 	case *api.BlockEvent:
 		block := event.Data.(*api.BlockEvent)
-		var dur time.Duration
-		if (last == time.Time{}) {
-			dur, _ = time.ParseDuration("0s")
-		} else {
-			dur = time.Since(last).Round(time.Millisecond)
+		now := time.Now()
+		dur, late := bm.slots.Receive(block.Slot, now)
+		dur = dur.Round(time.Millisecond)
+		// How far into its slot the block arrived
+		delay := bm.spec.Delay(block.Slot, now).Round(time.Millisecond)
+
+		if late {
+			log.Warn().Str("slot", fmt.Sprint(block.Slot)).Str("delay", delay.String()).Msg("Late block for a slot flagged as empty")
+			metrics.BeaconEmptySlots.Dec()
 		}
 
-		log.Info().Int("epoch", int(block.Slot/SLOTS_PER_EPOCH)).Str("slot", fmt.Sprint(block.Slot)).Str("last", dur.String()).Msg("New beacon block")
+		log.Info().Uint64("epoch", uint64(bm.spec.Epoch(block.Slot))).Str("slot", fmt.Sprint(block.Slot)).Str("last", dur.String()).Str("delay", delay.String()).Msg("New beacon block")
+		metrics.BeaconBlock(uint64(block.Slot), uint64(bm.spec.Epoch(block.Slot)))
+		metrics.BeaconBlockDelay.Observe(delay.Seconds())
 		bm.Reset <- true
-		last = time.Now()
+
+		for _, handler := range bm.blockHandlers {
+			handler(block)
+		}
 	case *api.FinalizedCheckpointEvent:
 		cp := event.Data.(*api.FinalizedCheckpointEvent)
 		log.Info().Str("epoch", fmt.Sprint(cp.Epoch)).Msg("Checkpoint finalized")
+		metrics.BeaconFinalizedEpoch.Set(float64(cp.Epoch))
 	case *api.ChainReorgEvent:
-		ev := event.Data.(*api.ChainReorgEvent)
-		log.Info().Uint64("depth", ev.Depth).Uint64("epoch", uint64(ev.Epoch)).Uint64("slot", uint64(ev.Slot)).Msg("Chain reorg")
+		// Resolving the blocks takes a few requests, don't hold up the stream
+		go bm.analyseReorg(event.Data.(*api.ChainReorgEvent))
 	default:
 		log.Warn().Str("event", event.String()).Msg("Unknown")
 	}
 
 }
 
+// watchSlots checks if we received a block for every slot. Blocks can be late, so a slot
+// is only flagged as empty at the end of the slot after it.
+func (bm BeaconMonitor) watchSlots() {
+	log := bm.Logger
+
+	bm.spec.OnSlot(func(slot phase0.Slot) {
+		// Don't flag anything before the first block, the node might still be syncing
+		if !bm.slots.Started() || slot < 2 {
+			return
+		}
+
+		check := slot - 2
+		if !bm.slots.Empty(check) {
+			return
+		}
+
+		log.Warn().Uint64("epoch", uint64(bm.spec.Epoch(check))).Str("slot", fmt.Sprint(check)).Msg("Empty slot")
+		metrics.BeaconEmptySlots.Inc()
+	})
+}
+
 func (bm BeaconMonitor) startBlockTimer() {
 	log := bm.Logger
 
@@ -168,20 +236,33 @@ func (bm BeaconMonitor) startBlockTimer() {
 		},
 		{
 			Duration: lvl3,
-			Timer:    time.NewTimer(lvl2),
+			Timer:    time.NewTimer(lvl3),
 		},
 	}
 
+	warn := func(lvl notify.Level, d time.Duration) {
+		log.Warn().Msgf("%s since last block", d)
+		sendAlert(bm.Notifier, log, notify.Alert{
+			Level:   lvl,
+			Source:  SourceBeacon,
+			Message: fmt.Sprintf("%s since last block", d),
+		})
+	}
+
 	for {
 		select {
-		case <-bm.Reset:
-			lvls.Reset()
+		case r := <-bm.Reset:
+			if r {
+				lvls.Reset()
+			} else {
+				lvls.Stop()
+			}
 		case <-lvls[0].Timer.C:
-			log.Warn().Msgf("%s since last block", lvls[0].Duration)
+			warn(notify.Info, lvls[0].Duration)
 		case <-lvls[1].Timer.C:
-			log.Warn().Msgf("%s since last block", lvls[1].Duration)
+			warn(notify.Warning, lvls[1].Duration)
 		case <-lvls[2].Timer.C:
-			log.Warn().Msgf("%s since last block", lvls[2].Duration)
+			warn(notify.Critical, lvls[2].Duration)
 		}
 	}
 }
@@ -201,9 +282,15 @@ func (bm BeaconMonitor) statLoop(interval time.Duration, topics map[string]inter
 	}
 
 	log.Info().Strs("topics", getKeys(topics)).Msg("Subscribed to topics")
+
+	sync := &beaconSyncState{}
+	inventory := &peerInventory{}
+	peerAlert := &peerCountAlert{Source: SourceBeacon}
+
 	for {
+		time.Sleep(interval)
+
 		if settings, ok := topics["p2p"]; ok {
-			time.Sleep(interval - 5*time.Second)
 			if settings.(config.Stat).Latency {
 				str := ""
 				if bm.InterfaceName != "" {
@@ -224,9 +311,21 @@ func (bm BeaconMonitor) statLoop(interval time.Duration, topics map[string]inter
 				log.Fatal().Err(err).Msg("")
 			}
 
-			time.Sleep(5 * time.Second)
+			metrics.BeaconPeers.WithLabelValues("connected").Set(float64(connected))
+			metrics.BeaconPeers.WithLabelValues("connecting").Set(float64(connecting))
+			metrics.BeaconPeers.WithLabelValues("disconnected").Set(float64(disconnected))
+			metrics.BeaconPeers.WithLabelValues("disconnecting").Set(float64(disconnecting))
+
+			// Give the latency scan some time
+			if settings.(config.Stat).Latency {
+				time.Sleep(5 * time.Second)
+			}
 
-			if connected < 20 {
+			if alert := peerAlert.Check(connected); alert != nil {
+				sendAlert(bm.Notifier, log, *alert)
+			}
+
+			if connected < minPeers {
 				log.Warn().Int("peer_count", connected).Msg("[P2P] Low peer count")
 			} else {
 				log.Info().Int(
@@ -236,8 +335,20 @@ func (bm BeaconMonitor) statLoop(interval time.Duration, topics map[string]inter
 					"disconnecting", disconnecting).Msg("[P2P] Network info")
 			}
 
-			if settings.(config.Stat).Latency {
-				log.Info().Str("high", res.High.String()).Str("low", res.Low.String()).Str("avg", res.Average.String()).Str("response_rate", fmt.Sprintf("%.2f%%", float64(res.Responses)/float64(res.Connected)*100)).Msg("[P2P] Latency scan results")
+			if settings.(config.Stat).Latency && res.Responses > 0 {
+				LogLatency(log, res)
+			}
+		}
+
+		if _, ok := topics["peers"]; ok {
+			if err := bm.peersStat(inventory); err != nil {
+				log.Error().Err(err).Msg("[PEERS] Error getting peers")
+			}
+		}
+
+		if _, ok := topics["sync"]; ok {
+			if err := bm.syncStat(sync); err != nil {
+				log.Error().Err(err).Msg("[SYNC] Error getting sync status")
 			}
 		}
 	}
@@ -282,8 +393,15 @@ func (bm BeaconMonitor) FinalityCheckpoints() (string, error) {
 	return gjson.GetBytes(body, "data").String(), nil
 }
 
+// Peer is a peer as returned by /eth/v1/node/peers.
 type Peer struct {
+	PeerID       string `json:"peer_id"`
+	ENR          string `json:"enr"`
 	MultiAddress string `json:"last_seen_p2p_address"`
+	State        string `json:"state"`
+	Direction    string `json:"direction"`
+	// Not part of the standard API, but returned by some clients
+	Agent string `json:"agent,omitempty"`
 }
 
 type PeersResponse struct {
@@ -296,6 +414,11 @@ type P2PScanResult struct {
 	Average   time.Duration
 	Connected int
 	Responses int
+	// Over the latency history window
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Slowest []PeerLatency
 }
 
 func (bm *BeaconMonitor) Peers(state string) ([]Peer, error) {
@@ -315,10 +438,34 @@ func (bm *BeaconMonitor) Peers(state string) ([]Peer, error) {
 	return peers.Data, nil
 }
 
+// multiaddrHostPort returns the "host:port" of a TCP multiaddr like /ip4/188.166.75.68/tcp/13000
+// or /ip6/2a01:4f8::1/tcp/9000. Other components, like the peer ID, are ignored.
+func multiaddrHostPort(addr string) (string, error) {
+	parts := strings.Split(addr, "/")
+
+	var ip gonet.IP
+	port := ""
+	for i := 1; i+1 < len(parts); i += 2 {
+		switch parts[i] {
+		case "ip4", "ip6":
+			ip = gonet.ParseIP(parts[i+1])
+		case "tcp":
+			port = parts[i+1]
+		}
+	}
+
+	if ip == nil || port == "" {
+		return "", fmt.Errorf("no TCP/IP address in multiaddr %s", addr)
+	}
+
+	return gonet.JoinHostPort(ip.String(), port), nil
+}
+
 func (bm BeaconMonitor) LatencyScan(iface string) (P2PScanResult, error) {
 	log := bm.Logger
 	var (
-		addrs []string
+		addrs   []string
+		peerIDs = make(map[string]string)
 	)
 
 	peers, err := bm.Peers("connected")
@@ -327,9 +474,14 @@ func (bm BeaconMonitor) LatencyScan(iface string) (P2PScanResult, error) {
 	}
 
 	for _, p := range peers {
-		// multiaddr format: /ip4/188.166.75.68/tcp/13000
-		tmp := strings.Split(p.MultiAddress, "/")
-		addrs = append(addrs, fmt.Sprintf("%s:%s", tmp[2], tmp[4]))
+		addr, err := multiaddrHostPort(p.MultiAddress)
+		if err != nil {
+			log.Debug().Err(err).Str("peer_id", p.PeerID).Msg("[P2P] Can't scan peer")
+			continue
+		}
+
+		addrs = append(addrs, addr)
+		peerIDs[addr] = p.PeerID
 	}
 	log.Trace().Int("connected", len(addrs)).Msg("[P2P] Starting latency scan")
 
@@ -337,16 +489,33 @@ func (bm BeaconMonitor) LatencyScan(iface string) (P2PScanResult, error) {
 		iface = bm.InterfaceName
 	}
 
-	if bm.Scanner == nil {
-		// No scanner created yet
-		bm.Scanner = net.NewScanner(iface)
-	}
-
-	results, err := bm.Scanner.StartLatencyScan(addrs)
+	results, err := bm.scanner.Get(iface).StartLatencyScan(addrs)
 	if err != nil {
 		return P2PScanResult{}, err
 	}
 
+	if len(results) == 0 {
+		return P2PScanResult{}, fmt.Errorf("none of the %d peers responded to the latency scan", len(addrs))
+	}
+
+	window, slowest := defaultLatencyWindow, defaultSlowestPeers
+	for _, stat := range bm.Stats {
+		if stat.ID != "p2p" {
+			continue
+		}
+
+		if stat.LatencyWindow > 0 {
+			window = stat.LatencyWindow
+		}
+
+		if stat.SlowestPeers > 0 {
+			slowest = stat.SlowestPeers
+		}
+	}
+
+	bm.latency.Add(results, peerIDs, window)
+	p50, p90, p99 := bm.latency.Percentiles()
+
 	hi := time.Nanosecond
 	lo := time.Minute
 	var total time.Duration
@@ -360,6 +529,7 @@ func (bm BeaconMonitor) LatencyScan(iface string) (P2PScanResult, error) {
 		}
 
 		total += v
+		metrics.BeaconPeerLatency.Observe(v.Seconds())
 	}
 
 	avg, err := time.ParseDuration(fmt.Sprintf("%dus", int(total.Microseconds())/len(results)))
@@ -367,11 +537,23 @@ func (bm BeaconMonitor) LatencyScan(iface string) (P2PScanResult, error) {
 		return P2PScanResult{}, err
 	}
 
+	metrics.BeaconLatency.WithLabelValues("high").Set(hi.Seconds())
+	metrics.BeaconLatency.WithLabelValues("low").Set(lo.Seconds())
+	metrics.BeaconLatency.WithLabelValues("avg").Set(avg.Seconds())
+	metrics.BeaconLatency.WithLabelValues("p50").Set(p50.Seconds())
+	metrics.BeaconLatency.WithLabelValues("p90").Set(p90.Seconds())
+	metrics.BeaconLatency.WithLabelValues("p99").Set(p99.Seconds())
+	metrics.BeaconLatencyResponseRate.Set(float64(len(results)) / float64(len(addrs)))
+
 	return P2PScanResult{
 		High:      hi,
 		Low:       lo,
 		Average:   avg,
 		Connected: len(addrs),
 		Responses: len(results),
+		P50:       p50,
+		P90:       p90,
+		P99:       p99,
+		Slowest:   bm.latency.Slowest(slowest),
 	}, nil
 }
@@ -0,0 +1,28 @@
+package monitor
+
+import "testing"
+
+func TestMultiaddrHostPort(t *testing.T) {
+	tests := map[string]string{
+		"/ip4/188.166.75.68/tcp/13000":                            "188.166.75.68:13000",
+		"/ip6/2a01:4f8:0:0::1/tcp/9000":                           "[2a01:4f8::1]:9000",
+		"/ip4/188.166.75.68/tcp/13000/p2p/16Uiu2HAm3bSw2oBqQPpeR": "188.166.75.68:13000",
+		"/ip4/188.166.75.68/udp/9000/quic-v1":                     "",
+		"/ip4/188.166.75.68":                                      "",
+		"":                                                        "",
+	}
+
+	for addr, want := range tests {
+		got, err := multiaddrHostPort(addr)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", addr, got)
+			}
+			continue
+		}
+
+		if err != nil || got != want {
+			t.Errorf("%q: expected %s, got %s (%v)", addr, want, got, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Defaults for the latency history, in scans and peers
+const (
+	defaultLatencyWindow = 10
+	defaultSlowestPeers  = 5
+)
+
+// PeerLatency is the latency history of a peer.
+type PeerLatency struct {
+	PeerID  string
+	Address string
+	// Round trip times of the scans in the window the peer responded to
+	RTTs []time.Duration
+	// Last scan the peer responded to
+	last int
+}
+
+// Median returns the median round trip time of the peer.
+func (p PeerLatency) Median() time.Duration {
+	return percentile(sortedDurations(p.RTTs), 50)
+}
+
+// latencyHistory keeps the latencies of the peers over the last scans, so a single
+// slow scan or peer doesn't skew the results.
+type latencyHistory struct {
+	mu    sync.Mutex
+	scans int
+	peers map[string]*PeerLatency
+}
+
+func newLatencyHistory() *latencyHistory {
+	return &latencyHistory{peers: make(map[string]*PeerLatency)}
+}
+
+// Add records the results of a scan by address. Peers that didn't respond to any scan in
+// the window are forgotten.
+func (h *latencyHistory) Add(results map[string]time.Duration, peerIDs map[string]string, window int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.scans++
+
+	for addr, rtt := range results {
+		p, ok := h.peers[addr]
+		if !ok {
+			p = &PeerLatency{Address: addr}
+			h.peers[addr] = p
+		}
+
+		// Addresses can be reused by another peer
+		if id := peerIDs[addr]; id != p.PeerID {
+			p.PeerID, p.RTTs = id, nil
+		}
+
+		p.RTTs = append(p.RTTs, rtt)
+		if len(p.RTTs) > window {
+			p.RTTs = p.RTTs[len(p.RTTs)-window:]
+		}
+		p.last = h.scans
+	}
+
+	for addr, p := range h.peers {
+		if h.scans-p.last >= window {
+			delete(h.peers, addr)
+		}
+	}
+}
+
+// Percentiles returns the p50, p90 and p99 of all the round trip times in the window.
+func (h *latencyHistory) Percentiles() (p50, p90, p99 time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var all []time.Duration
+	for _, p := range h.peers {
+		all = append(all, p.RTTs...)
+	}
+	sorted := sortedDurations(all)
+
+	return percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99)
+}
+
+// Slowest returns the n peers with the highest median round trip time, slowest first.
+func (h *latencyHistory) Slowest(n int) []PeerLatency {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	peers := make([]PeerLatency, 0, len(h.peers))
+	for _, p := range h.peers {
+		peers = append(peers, PeerLatency{PeerID: p.PeerID, Address: p.Address, RTTs: append([]time.Duration(nil), p.RTTs...)})
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Median() > peers[j].Median() })
+
+	if len(peers) > n {
+		peers = peers[:n]
+	}
+
+	return peers
+}
+
+func sortedDurations(d []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), d...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted
+}
+
+// percentile returns the nearest rank percentile p of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// LogLatency logs the results of a latency scan, and the slowest peers.
+func LogLatency(log zerolog.Logger, res P2PScanResult) {
+	log.Info().Str("high", res.High.String()).
+		Str("low", res.Low.String()).
+		Str("avg", res.Average.String()).
+		Str("p50", res.P50.String()).
+		Str("p90", res.P90.String()).
+		Str("p99", res.P99.String()).
+		Str("response_rate", fmt.Sprintf("%.2f%%", float64(res.Responses)/float64(res.Connected)*100)).
+		Msg("[P2P] Latency scan results")
+
+	for _, p := range res.Slowest {
+		log.Info().Str("peer_id", p.PeerID).
+			Str("address", p.Address).
+			Str("median", p.Median().Round(time.Microsecond).String()).
+			Int("samples", len(p.RTTs)).
+			Msg("[P2P] Slow peer")
+	}
+}
@@ -0,0 +1,38 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistory(t *testing.T) {
+	h := newLatencyHistory()
+	ms := time.Millisecond
+
+	ids := map[string]string{"a:1": "peer-a", "b:1": "peer-b", "c:1": "peer-c"}
+
+	h.Add(map[string]time.Duration{"a:1": 10 * ms, "b:1": 100 * ms, "c:1": 20 * ms}, ids, 3)
+	h.Add(map[string]time.Duration{"a:1": 12 * ms, "b:1": 300 * ms}, ids, 3)
+	h.Add(map[string]time.Duration{"a:1": 14 * ms, "b:1": 200 * ms}, ids, 3)
+
+	// 10 12 14 20 100 200 300
+	p50, p90, p99 := h.Percentiles()
+	if p50 != 20*ms || p90 != 300*ms || p99 != 300*ms {
+		t.Errorf("unexpected percentiles %s %s %s", p50, p90, p99)
+	}
+
+	slowest := h.Slowest(2)
+	if len(slowest) != 2 || slowest[0].PeerID != "peer-b" || slowest[0].Median() != 200*ms || slowest[1].PeerID != "peer-c" {
+		t.Errorf("unexpected slowest peers %+v", slowest)
+	}
+
+	// c didn't respond for the whole window, and a's oldest sample drops out
+	h.Add(map[string]time.Duration{"a:1": 16 * ms}, ids, 3)
+	if _, ok := h.peers["c:1"]; ok {
+		t.Error("expected c to be forgotten")
+	}
+
+	if rtts := h.peers["a:1"].RTTs; len(rtts) != 3 || rtts[0] != 12*ms {
+		t.Errorf("unexpected window %v", rtts)
+	}
+}
@@ -0,0 +1,254 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/netbound/e7mon/metrics"
+
+	"github.com/tidwall/gjson"
+)
+
+// Consensus clients by the prefix of their agent string
+var consensusClients = []string{"lighthouse", "prysm", "teku", "nimbus", "lodestar", "grandine", "erigon"}
+
+// Client returns the consensus client of the peer from its agent, e.g. "Lighthouse/v5.1.3-3058b96/x86_64-linux".
+func (p Peer) Client() string {
+	agent := strings.ToLower(p.Agent)
+	if agent == "" {
+		return "unknown"
+	}
+
+	for _, c := range consensusClients {
+		if strings.HasPrefix(agent, c) {
+			return c
+		}
+	}
+
+	return "other"
+}
+
+// Identity is our own node, as returned by /eth/v1/node/identity.
+type Identity struct {
+	PeerID       string
+	ENR          string
+	P2PAddresses []string
+}
+
+// Identity returns the peer ID, ENR and addresses of the node.
+func (bm BeaconMonitor) Identity() (*Identity, error) {
+	body, err := getJSON(bm.Config.API + "/eth/v1/node/identity")
+	if err != nil {
+		return nil, err
+	}
+
+	data := gjson.GetBytes(body, "data")
+
+	id := &Identity{
+		PeerID: data.Get("peer_id").String(),
+		ENR:    data.Get("enr").String(),
+	}
+	for _, a := range data.Get("p2p_addresses").Array() {
+		id.P2PAddresses = append(id.P2PAddresses, a.String())
+	}
+
+	return id, nil
+}
+
+// PeerInfo returns a single peer, some clients only return its agent here.
+func (bm BeaconMonitor) PeerInfo(id string) (*Peer, error) {
+	body, err := getJSON(bm.Config.API + "/eth/v1/node/peers/" + id)
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return nil, fmt.Errorf("peer %s not found", id)
+	}
+
+	data := gjson.GetBytes(body, "data")
+
+	return &Peer{
+		PeerID:       data.Get("peer_id").String(),
+		ENR:          data.Get("enr").String(),
+		MultiAddress: data.Get("last_seen_p2p_address").String(),
+		State:        data.Get("state").String(),
+		Direction:    data.Get("direction").String(),
+		Agent:        data.Get("agent").String(),
+	}, nil
+}
+
+// peerInventory is kept between runs of the peers stat, for the churn.
+type peerInventory struct {
+	// Connected peers by ID
+	peers   map[string]Peer
+	sampled bool
+}
+
+// PeerSummary breaks down the connected peers.
+type PeerSummary struct {
+	Inbound  int
+	Outbound int
+	// Peers without a direction, not all clients report it
+	Unknown int
+	// Peers by consensus client
+	Clients map[string]int
+	// Peer IDs since the last inventory
+	Added   []string
+	Dropped []string
+}
+
+// Connected returns the number of connected peers.
+func (s PeerSummary) Connected() int {
+	return s.Inbound + s.Outbound + s.Unknown
+}
+
+// FormatClients returns the client diversity, most used client first.
+func (s PeerSummary) FormatClients() string {
+	clients := make([]string, 0, len(s.Clients))
+	for c := range s.Clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if s.Clients[clients[i]] == s.Clients[clients[j]] {
+			return clients[i] < clients[j]
+		}
+		return s.Clients[clients[i]] > s.Clients[clients[j]]
+	})
+
+	parts := make([]string, len(clients))
+	for i, c := range clients {
+		parts[i] = fmt.Sprintf("%s=%d (%.0f%%)", c, s.Clients[c], float64(s.Clients[c])/float64(s.Connected())*100)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// takeInventory lists the connected peers, resolves their agents and compares them with
+// the previous inventory.
+func (bm BeaconMonitor) takeInventory(inv *peerInventory) ([]Peer, *PeerSummary, error) {
+	peers, err := bm.Peers("connected")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := &PeerSummary{Clients: make(map[string]int)}
+	current := make(map[string]Peer, len(peers))
+
+	for i, p := range peers {
+		if p.Agent == "" {
+			if known, ok := inv.peers[p.PeerID]; ok {
+				p.Agent = known.Agent
+			} else if info, err := bm.PeerInfo(p.PeerID); err == nil {
+				p.Agent = info.Agent
+			} else {
+				bm.Logger.Debug().Err(err).Str("peer_id", p.PeerID).Msg("[PEERS] Error getting peer")
+			}
+			peers[i] = p
+		}
+
+		switch p.Direction {
+		case "inbound":
+			summary.Inbound++
+		case "outbound":
+			summary.Outbound++
+		default:
+			summary.Unknown++
+		}
+		summary.Clients[p.Client()]++
+
+		current[p.PeerID] = p
+		if _, ok := inv.peers[p.PeerID]; inv.sampled && !ok {
+			summary.Added = append(summary.Added, p.PeerID)
+		}
+	}
+
+	for id := range inv.peers {
+		if _, ok := current[id]; !ok {
+			summary.Dropped = append(summary.Dropped, id)
+		}
+	}
+
+	inv.peers, inv.sampled = current, true
+
+	return peers, summary, nil
+}
+
+// peersStat reports the direction, client diversity and churn of the connected peers.
+func (bm BeaconMonitor) peersStat(inv *peerInventory) error {
+	log := bm.Logger
+
+	_, summary, err := bm.takeInventory(inv)
+	if err != nil {
+		return err
+	}
+
+	metrics.BeaconPeerDirection.WithLabelValues("inbound").Set(float64(summary.Inbound))
+	metrics.BeaconPeerDirection.WithLabelValues("outbound").Set(float64(summary.Outbound))
+	metrics.BeaconPeerDirection.WithLabelValues("unknown").Set(float64(summary.Unknown))
+	metrics.BeaconPeerClients.Reset()
+	for c, n := range summary.Clients {
+		metrics.BeaconPeerClients.WithLabelValues(c).Set(float64(n))
+	}
+	metrics.BeaconPeerChurn.WithLabelValues("added").Add(float64(len(summary.Added)))
+	metrics.BeaconPeerChurn.WithLabelValues("dropped").Add(float64(len(summary.Dropped)))
+
+	bm.logSummary(summary)
+
+	// Usually means the P2P port isn't reachable
+	if summary.Inbound == 0 && summary.Outbound > 0 {
+		log.Warn().Int("outbound", summary.Outbound).Msg("[PEERS] No inbound peers, is the P2P port open?")
+	}
+
+	return nil
+}
+
+func (bm BeaconMonitor) logSummary(summary *PeerSummary) {
+	ratio := "n/a"
+	if summary.Outbound > 0 {
+		ratio = fmt.Sprintf("%.2f", float64(summary.Inbound)/float64(summary.Outbound))
+	}
+
+	bm.Logger.Info().Int("connected", summary.Connected()).
+		Int("inbound", summary.Inbound).
+		Int("outbound", summary.Outbound).
+		Int("unknown_direction", summary.Unknown).
+		Str("in_out_ratio", ratio).
+		Str("clients", summary.FormatClients()).
+		Int("added", len(summary.Added)).
+		Int("dropped", len(summary.Dropped)).
+		Msg("[PEERS] Peer inventory")
+}
+
+// PrintPeers prints our node and its connected peers.
+func (bm BeaconMonitor) PrintPeers() error {
+	log := bm.Logger
+
+	id, err := bm.Identity()
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("peer_id", id.PeerID).Strs("addresses", id.P2PAddresses).Str("enr", id.ENR).Msg("[PEERS] Our node")
+
+	peers, summary, err := bm.takeInventory(&peerInventory{})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Client() < peers[j].Client() })
+
+	for _, p := range peers {
+		log.Info().Str("peer_id", p.PeerID).
+			Str("direction", p.Direction).
+			Str("client", p.Client()).
+			Str("agent", p.Agent).
+			Str("address", p.MultiAddress).
+			Msg("[PEERS] Peer")
+	}
+
+	bm.logSummary(summary)
+
+	return nil
+}
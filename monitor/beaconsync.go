@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"fmt"
+	web "net/http"
+	"strings"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/tidwall/gjson"
+)
+
+// Node health as reported by /eth/v1/node/health
+const (
+	HealthReady          = web.StatusOK
+	HealthSyncing        = web.StatusPartialContent
+	HealthNotInitialized = web.StatusServiceUnavailable
+)
+
+// BeaconSyncStatus is the result of /eth/v1/node/syncing.
+type BeaconSyncStatus struct {
+	HeadSlot     uint64
+	SyncDistance uint64
+	IsSyncing    bool
+	IsOptimistic bool
+	// Not reported by all clients
+	ELOffline bool
+}
+
+// beaconSyncState is kept between runs of the sync stat.
+type beaconSyncState struct {
+	Sampled  bool
+	Distance uint64
+
+	Syncing    bool
+	Optimistic bool
+	ELOffline  bool
+	Unhealthy  bool
+}
+
+// SyncStatus returns the sync status of the node.
+func (bm BeaconMonitor) SyncStatus() (*BeaconSyncStatus, error) {
+	body, err := getJSON(bm.Config.API + "/eth/v1/node/syncing")
+	if err != nil {
+		return nil, err
+	}
+
+	data := gjson.GetBytes(body, "data")
+
+	return &BeaconSyncStatus{
+		HeadSlot:     data.Get("head_slot").Uint(),
+		SyncDistance: data.Get("sync_distance").Uint(),
+		IsSyncing:    data.Get("is_syncing").Bool(),
+		IsOptimistic: data.Get("is_optimistic").Bool(),
+		ELOffline:    data.Get("el_offline").Bool(),
+	}, nil
+}
+
+// Health returns the status code of the health endpoint, see the Health constants.
+func (bm BeaconMonitor) Health() (int, error) {
+	res, err := web.Get(bm.Config.API + "/eth/v1/node/health")
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	return res.StatusCode, nil
+}
+
+// syncStat reports the sync status and health of the node. Syncing, optimistic and
+// EL offline are the states in which our validators silently miss their duties.
+func (bm BeaconMonitor) syncStat(state *beaconSyncState) error {
+	log := bm.Logger
+
+	status, err := bm.SyncStatus()
+	if err != nil {
+		return err
+	}
+
+	health, err := bm.Health()
+	if err != nil {
+		return err
+	}
+
+	metrics.BeaconSyncDistance.Set(float64(status.SyncDistance))
+	metrics.BeaconOptimistic.Set(boolToFloat(status.IsOptimistic))
+	metrics.BeaconELOffline.Set(boolToFloat(status.ELOffline))
+
+	// Distance grows when the node falls behind, instead of catching up
+	growing := state.Sampled && status.SyncDistance > state.Distance
+
+	var problems []string
+	if status.IsSyncing {
+		ev := log.Warn().Uint64("head_slot", status.HeadSlot).Uint64("sync_distance", status.SyncDistance)
+		if state.Sampled {
+			ev = ev.Str("trend", fmt.Sprintf("%+d", int64(status.SyncDistance)-int64(state.Distance)))
+		}
+		ev.Msg("[SYNC] Node is syncing")
+
+		if !state.Syncing || growing {
+			problems = append(problems, fmt.Sprintf("syncing, %d slots behind", status.SyncDistance))
+		}
+	} else if status.SyncDistance > 1 && growing {
+		log.Warn().Uint64("head_slot", status.HeadSlot).Uint64("sync_distance", status.SyncDistance).Msg("[SYNC] Node is falling behind")
+		problems = append(problems, fmt.Sprintf("falling behind, %d slots behind", status.SyncDistance))
+	}
+
+	if status.IsOptimistic {
+		log.Warn().Uint64("head_slot", status.HeadSlot).Msg("[SYNC] Node is optimistic, the execution client hasn't verified the head")
+		if !state.Optimistic {
+			problems = append(problems, "optimistic")
+		}
+	}
+
+	if status.ELOffline {
+		log.Error().Msg("[SYNC] Execution client is offline")
+		if !state.ELOffline {
+			problems = append(problems, "execution client offline")
+		}
+	}
+
+	if health == HealthNotInitialized {
+		log.Error().Int("status", health).Msg("[SYNC] Node is not initialized or has issues")
+		if !state.Unhealthy {
+			problems = append(problems, "unhealthy")
+		}
+	}
+
+	ok := !status.IsSyncing && !status.IsOptimistic && !status.ELOffline && health == HealthReady
+	if ok {
+		if state.Syncing || state.Optimistic || state.ELOffline || state.Unhealthy {
+			log.Info().Uint64("head_slot", status.HeadSlot).Msg("[SYNC] Node is synced and healthy again")
+			sendAlert(bm.Notifier, log, notify.Alert{
+				Level:   notify.Info,
+				Source:  SourceBeacon,
+				Message: "Node is synced and healthy again",
+			})
+		} else {
+			log.Info().Uint64("head_slot", status.HeadSlot).Uint64("sync_distance", status.SyncDistance).Msg("[SYNC] Node is synced")
+		}
+	}
+
+	if len(problems) > 0 {
+		sendAlert(bm.Notifier, log, notify.Alert{
+			Level:   notify.Critical,
+			Source:  SourceBeacon,
+			Message: fmt.Sprintf("Node is %s, validators might miss their duties", strings.Join(problems, ", ")),
+		})
+	}
+
+	state.Sampled, state.Distance = true, status.SyncDistance
+	state.Syncing, state.Optimistic, state.ELOffline = status.IsSyncing, status.IsOptimistic, status.ELOffline
+	state.Unhealthy = health == HealthNotInitialized
+
+	return nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
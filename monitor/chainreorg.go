@@ -0,0 +1,310 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	api "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/tidwall/gjson"
+)
+
+// Blocks to walk back at most per chain, deeper reorgs are only partially resolved
+const maxReorgWalk = 64
+
+// reorgBlock is a block of one of the chains involved in a reorg.
+type reorgBlock struct {
+	Slot     phase0.Slot
+	Root     phase0.Root
+	Proposer phase0.ValidatorIndex
+	// Message of the block, for the attestations
+	Message gjson.Result
+}
+
+// ChainReorg is a chain_reorg event with the blocks of the old and new chain, newest first.
+type ChainReorg struct {
+	Event    *api.ChainReorgEvent
+	Ancestor phase0.Slot
+	Orphaned []reorgBlock
+	New      []reorgBlock
+}
+
+// OnReorg registers a handler that is called with every analysed chain reorg. Has to be
+// called before starting the monitor.
+func (bm *BeaconMonitor) OnReorg(handler func(*ChainReorg)) {
+	bm.reorgHandlers = append(bm.reorgHandlers, handler)
+}
+
+// chainSince returns the blocks from head back to (excluding) the ancestor slot. Orphaned
+// blocks are only available while the node keeps them, so the chain can be incomplete.
+func (bm BeaconMonitor) chainSince(head phase0.Root, ancestor phase0.Slot) ([]reorgBlock, error) {
+	var blocks []reorgBlock
+
+	root := head
+	for i := 0; i < maxReorgWalk; i++ {
+		body, err := getJSON(fmt.Sprintf("%s/eth/v2/beacon/blocks/%#x", bm.Config.API, root))
+		if err != nil {
+			return blocks, err
+		}
+
+		if body == nil {
+			return blocks, fmt.Errorf("block %#x not found", root)
+		}
+
+		msg := gjson.GetBytes(body, "data.message")
+		slot := phase0.Slot(msg.Get("slot").Uint())
+		if slot <= ancestor {
+			break
+		}
+
+		blocks = append(blocks, reorgBlock{
+			Slot:     slot,
+			Root:     root,
+			Proposer: phase0.ValidatorIndex(msg.Get("proposer_index").Uint()),
+			Message:  msg,
+		})
+
+		root, err = parseRoot(msg.Get("parent_root").String())
+		if err != nil {
+			return blocks, err
+		}
+	}
+
+	return blocks, nil
+}
+
+// analyseReorg resolves the blocks of the old and new chain, reports the reorg with a
+// level based on its depth, and passes it on to the reorg handlers.
+func (bm BeaconMonitor) analyseReorg(event *api.ChainReorgEvent) {
+	log := bm.Logger
+
+	reorg := &ChainReorg{Event: event}
+	if uint64(event.Slot) > event.Depth {
+		reorg.Ancestor = event.Slot - phase0.Slot(event.Depth)
+	}
+
+	var err error
+	reorg.Orphaned, err = bm.chainSince(event.OldHeadBlock, reorg.Ancestor)
+	if err != nil {
+		log.Debug().Err(err).Msg("Error resolving the orphaned blocks")
+	}
+
+	reorg.New, err = bm.chainSince(event.NewHeadBlock, reorg.Ancestor)
+	if err != nil {
+		log.Debug().Err(err).Msg("Error resolving the new blocks")
+	}
+
+	metrics.BeaconReorgs.Inc()
+	metrics.BeaconReorgDepth.Observe(float64(event.Depth))
+
+	level, deep := reorgLevel(event.Depth, bm.Config.Settings.ReorgDepthLevels)
+
+	ev := log.Info()
+	if deep {
+		ev = log.Warn()
+	}
+
+	ev.Uint64("depth", event.Depth).
+		Uint64("epoch", uint64(event.Epoch)).
+		Uint64("slot", uint64(event.Slot)).
+		Str("old_head", fmt.Sprintf("%#x", event.OldHeadBlock)).
+		Str("new_head", fmt.Sprintf("%#x", event.NewHeadBlock)).
+		Str("orphaned_proposers", formatProposers(reorg.Orphaned)).
+		Str("new_proposers", formatProposers(reorg.New)).
+		Msg("Chain reorg")
+
+	if deep {
+		sendAlert(bm.Notifier, log, notify.Alert{
+			Level:   level,
+			Source:  SourceBeacon,
+			Message: fmt.Sprintf("Chain reorg of depth %d at slot %d, orphaned %d blocks by proposers %s", event.Depth, event.Slot, len(reorg.Orphaned), formatProposers(reorg.Orphaned)),
+		})
+	}
+
+	for _, handler := range bm.reorgHandlers {
+		handler(reorg)
+	}
+}
+
+// reorgLevel returns the alert level for the highest depth level the reorg crossed. Deep is
+// false for normal reorgs below the first level.
+func reorgLevel(depth uint64, levels []uint64) (level notify.Level, deep bool) {
+	if len(levels) != 3 {
+		levels = []uint64{2, 3, 4}
+	}
+
+	for i, l := range levels {
+		if depth >= l {
+			level, deep = thresholdLevels[i], true
+		}
+	}
+
+	return level, deep
+}
+
+// formatProposers lists the proposers of the blocks with their slots.
+func formatProposers(blocks []reorgBlock) string {
+	if len(blocks) == 0 {
+		return "unknown"
+	}
+
+	s := make([]string, len(blocks))
+	for i, b := range blocks {
+		s[i] = fmt.Sprintf("%d (slot %d)", b.Proposer, b.Slot)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// HandleReorg checks if blocks or attestations of our validators were orphaned by the reorg.
+func (vm *ValidatorMonitor) HandleReorg(reorg *ChainReorg) {
+	log := vm.Logger
+
+	vm.mu.Lock()
+	ready := vm.ready
+	vm.mu.Unlock()
+
+	// Not started yet
+	if !ready {
+		return
+	}
+
+	for _, b := range reorg.Orphaned {
+		if !vm.monitored[b.Proposer] {
+			continue
+		}
+
+		log.Error().Uint64("validator_index", uint64(b.Proposer)).Uint64("slot", uint64(b.Slot)).Uint64("depth", reorg.Event.Depth).Msg("Block proposal orphaned by reorg")
+		sendAlert(vm.Notifier, log, notify.Alert{
+			Level:   notify.Critical,
+			Source:  SourceValidator,
+			Message: fmt.Sprintf("Block proposed by validator %d in slot %d was orphaned by a reorg of depth %d", b.Proposer, b.Slot, reorg.Event.Depth),
+		})
+	}
+
+	orphaned, err := vm.ourAttesters(reorg.Orphaned)
+	if err != nil {
+		log.Error().Err(err).Msg("Error checking for orphaned attestations")
+		return
+	}
+
+	if len(orphaned) == 0 {
+		return
+	}
+
+	// Attestations that made it into the new chain as well weren't lost
+	included, err := vm.ourAttesters(reorg.New)
+	if err != nil {
+		log.Error().Err(err).Msg("Error checking for orphaned attestations")
+		return
+	}
+
+	var lost []phase0.ValidatorIndex
+	for index := range orphaned {
+		if !included[index] {
+			lost = append(lost, index)
+		}
+	}
+
+	if len(lost) == 0 {
+		return
+	}
+
+	sort.Slice(lost, func(i, j int) bool { return lost[i] < lost[j] })
+
+	log.Warn().Str("validators", fmt.Sprint(lost)).Uint64("depth", reorg.Event.Depth).Msg("Attestations orphaned by reorg")
+	sendAlert(vm.Notifier, log, notify.Alert{
+		Level:   notify.Warning,
+		Source:  SourceValidator,
+		Message: fmt.Sprintf("Attestations of %d validators were orphaned by a reorg of depth %d, they might be included again", len(lost), reorg.Event.Depth),
+	})
+}
+
+// ourAttesters returns our validators with attestations in the blocks.
+func (vm *ValidatorMonitor) ourAttesters(blocks []reorgBlock) (map[phase0.ValidatorIndex]bool, error) {
+	ours := make(map[phase0.ValidatorIndex]bool)
+
+	// Committees by attestation slot, the reorg might span a few
+	committees := make(map[phase0.Slot]map[phase0.CommitteeIndex][]phase0.ValidatorIndex)
+
+	for _, b := range blocks {
+		attestations, err := vm.decodeAttestations(b.Message, b.Slot)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, att := range attestations {
+			members, ok := committees[att.Data.Slot]
+			if !ok {
+				members, err = vm.committeeMembers(att.Data.Slot)
+				if err != nil {
+					return nil, err
+				}
+				committees[att.Data.Slot] = members
+			}
+
+			for _, index := range attestingIndices(att, members) {
+				if vm.monitored[index] {
+					ours[index] = true
+				}
+			}
+		}
+	}
+
+	return ours, nil
+}
+
+// committeeMembers returns the validators of the committees at slot.
+func (vm *ValidatorMonitor) committeeMembers(slot phase0.Slot) (map[phase0.CommitteeIndex][]phase0.ValidatorIndex, error) {
+	body, err := getJSON(fmt.Sprintf("%s/eth/v1/beacon/states/head/committees?slot=%d", vm.API, slot))
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[phase0.CommitteeIndex][]phase0.ValidatorIndex)
+	for _, c := range gjson.GetBytes(body, "data").Array() {
+		index := phase0.CommitteeIndex(c.Get("index").Uint())
+		for _, v := range c.Get("validators").Array() {
+			members[index] = append(members[index], phase0.ValidatorIndex(v.Uint()))
+		}
+	}
+
+	return members, nil
+}
+
+// attestingIndices returns the validators that voted in the attestation. Since Electra an
+// attestation can span several committees, their bits are concatenated.
+func attestingIndices(att *attestation, committees map[phase0.CommitteeIndex][]phase0.ValidatorIndex) []phase0.ValidatorIndex {
+	var indices []phase0.ValidatorIndex
+
+	if att.CommitteeBits == nil {
+		for i, index := range committees[att.Data.Index] {
+			if att.AggregationBits.BitAt(uint64(i)) {
+				indices = append(indices, index)
+			}
+		}
+
+		return indices
+	}
+
+	var offset uint64
+	for c := uint64(0); c < uint64(len(att.CommitteeBits))*8; c++ {
+		if !bitAt(att.CommitteeBits, c) {
+			continue
+		}
+
+		members := committees[phase0.CommitteeIndex(c)]
+		for i, index := range members {
+			if att.AggregationBits.BitAt(offset + uint64(i)) {
+				indices = append(indices, index)
+			}
+		}
+		offset += uint64(len(members))
+	}
+
+	return indices
+}
@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+func TestReorgLevel(t *testing.T) {
+	if _, deep := reorgLevel(1, nil); deep {
+		t.Error("expected a single slot reorg not to be deep")
+	}
+
+	expected := map[uint64]notify.Level{2: notify.Info, 3: notify.Warning, 4: notify.Critical, 10: notify.Critical}
+	for depth, want := range expected {
+		if level, deep := reorgLevel(depth, nil); !deep || level != want {
+			t.Errorf("depth %d: expected %s, got %s", depth, want, level)
+		}
+	}
+
+	// Configured levels
+	if level, deep := reorgLevel(5, []uint64{3, 5, 8}); !deep || level != notify.Warning {
+		t.Errorf("expected warning, got %s", level)
+	}
+}
+
+func TestAttestingIndices(t *testing.T) {
+	committees := map[phase0.CommitteeIndex][]phase0.ValidatorIndex{
+		0: {10, 11},
+		1: {20, 21, 22},
+		2: {30, 31, 32},
+	}
+
+	// Committee 1, bit 2 and the length bit
+	att := &attestation{Attestation: &phase0.Attestation{
+		AggregationBits: []byte{0x0c},
+		Data:            &phase0.AttestationData{Index: 1},
+	}}
+
+	if got := fmt.Sprint(attestingIndices(att, committees)); got != "[22]" {
+		t.Errorf("expected [22], got %s", got)
+	}
+
+	// Electra attestation for committees 0 and 2, bit 1 of each and the length bit
+	att = &attestation{
+		Attestation: &phase0.Attestation{
+			AggregationBits: []byte{0x2a},
+			Data:            &phase0.AttestationData{},
+		},
+		CommitteeBits: []byte{0x05},
+	}
+
+	if got := fmt.Sprint(attestingIndices(att, committees)); got != "[11 31]" {
+		t.Errorf("expected [11 31], got %s", got)
+	}
+}
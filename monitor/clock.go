@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// SlotStart returns the time at which slot starts.
+func (s *Spec) SlotStart(slot phase0.Slot) time.Time {
+	return s.Genesis.Add(time.Duration(slot) * s.SlotDuration)
+}
+
+// CurrentSlot returns the slot we're in right now.
+func (s *Spec) CurrentSlot() phase0.Slot {
+	if time.Now().Before(s.Genesis) {
+		return 0
+	}
+
+	return phase0.Slot(time.Since(s.Genesis) / s.SlotDuration)
+}
+
+// CurrentEpoch returns the epoch we're in right now.
+func (s *Spec) CurrentEpoch() phase0.Epoch {
+	return s.Epoch(s.CurrentSlot())
+}
+
+// Delay returns how far into its slot t is.
+func (s *Spec) Delay(slot phase0.Slot, t time.Time) time.Duration {
+	return t.Sub(s.SlotStart(slot))
+}
+
+// OnSlot calls handler at the start of every slot, with the slot that just started.
+// It blocks forever.
+func (s *Spec) OnSlot(handler func(phase0.Slot)) {
+	for {
+		next := s.CurrentSlot() + 1
+		time.Sleep(time.Until(s.SlotStart(next)))
+		handler(next)
+	}
+}
+
+// Slots to remember empty slots for, blocks arriving even later aren't recognized as late
+const emptySlotMemory = 64
+
+// slotTracker keeps track of the slots a block was received for. It's shared
+// between the event handler and the slot ticker.
+type slotTracker struct {
+	mu       sync.Mutex
+	received map[phase0.Slot]time.Time
+	// Slots flagged as empty, in case their block still comes in
+	empty map[phase0.Slot]bool
+	last  time.Time
+}
+
+func newSlotTracker() *slotTracker {
+	return &slotTracker{
+		received: make(map[phase0.Slot]time.Time),
+		empty:    make(map[phase0.Slot]bool),
+	}
+}
+
+// Receive records the arrival of a block for slot and returns the time since the
+// previous block, which is zero for the first block. Late is true if the slot was
+// already flagged as empty.
+func (t *slotTracker) Receive(slot phase0.Slot, at time.Time) (since time.Duration, late bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.last.IsZero() {
+		since = at.Sub(t.last)
+	}
+
+	t.last = at
+	t.received[slot] = at
+
+	late = t.empty[slot]
+	delete(t.empty, slot)
+
+	return since, late
+}
+
+// Empty reports if no block was received for slot, and remembers it as empty if so.
+// Slots before it are forgotten.
+func (t *slotTracker) Empty(slot phase0.Slot) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.received[slot]
+	for s := range t.received {
+		if s < slot {
+			delete(t.received, s)
+		}
+	}
+
+	for s := range t.empty {
+		if uint64(s)+emptySlotMemory < uint64(slot) {
+			delete(t.empty, s)
+		}
+	}
+
+	if !ok {
+		t.empty[slot] = true
+	}
+
+	return !ok
+}
+
+// Started reports if any block was received yet.
+func (t *slotTracker) Started() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return !t.last.IsZero()
+}
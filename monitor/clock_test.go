@@ -0,0 +1,38 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlotTrackerLateBlock(t *testing.T) {
+	tr := newSlotTracker()
+	now := time.Now()
+
+	if _, late := tr.Receive(10, now); late {
+		t.Error("expected a block on time")
+	}
+
+	if tr.Empty(10) {
+		t.Error("expected slot 10 to have a block")
+	}
+
+	if !tr.Empty(11) {
+		t.Error("expected slot 11 to be empty")
+	}
+
+	// The block for slot 11 still comes in
+	since, late := tr.Receive(11, now.Add(30*time.Second))
+	if !late {
+		t.Error("expected the block for slot 11 to be late")
+	}
+
+	if since != 30*time.Second {
+		t.Errorf("expected 30s since the last block, got %s", since)
+	}
+
+	// Only reported as late once
+	if _, late := tr.Receive(11, now.Add(31*time.Second)); late {
+		t.Error("expected the late block to be reported once")
+	}
+}
@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	web "net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/tidwall/gjson"
+)
+
+// Capabilities we announce to the execution client, only used to get a response
+var engineCapabilities = []string{
+	"engine_newPayloadV1",
+	"engine_forkchoiceUpdatedV1",
+	"engine_getPayloadV1",
+}
+
+// errJWTRejected is returned when the execution client doesn't accept our token.
+var errJWTRejected = errors.New("JWT rejected, do the execution and beacon clients use the same jwt secret?")
+
+// readJWTSecret reads the hex encoded 32 byte secret shared by the execution and beacon clients.
+func readJWTSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt secret in %s: %w", path, err)
+	}
+
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("invalid jwt secret in %s: expected 32 bytes, got %d", path, len(secret))
+	}
+
+	return secret, nil
+}
+
+// jwtToken returns a HS256 token with only the issued at claim, as required by the Engine API.
+// Tokens are only valid for a minute around iat, so one is signed for every request.
+func jwtToken(secret []byte, iat time.Time) string {
+	enc := base64.RawURLEncoding
+
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		enc.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d}`, iat.Unix())))
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+// EngineCapabilities calls engine_exchangeCapabilities on the authenticated Engine API. It
+// returns the capabilities of the execution client, and the round trip time.
+func (em ExecutionMonitor) EngineCapabilities(secret []byte) ([]string, time.Duration, error) {
+	params := `"` + strings.Join(engineCapabilities, `","`) + `"`
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"engine_exchangeCapabilities","params":[[%s]]}`, params)
+
+	req, err := web.NewRequest("POST", em.Config.Engine.URL, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwtToken(secret, time.Now()))
+
+	client := web.Client{Timeout: 10 * time.Second}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	rtt := time.Since(start)
+
+	if res.StatusCode == web.StatusUnauthorized || res.StatusCode == web.StatusForbidden {
+		return nil, rtt, errJWTRejected
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, rtt, err
+	}
+
+	if res.StatusCode != web.StatusOK {
+		return nil, rtt, fmt.Errorf("POST %s: %s", em.Config.Engine.URL, res.Status)
+	}
+
+	// Clients from before the method existed reply with an error, but the token was accepted
+	var capabilities []string
+	for _, c := range gjson.GetBytes(data, "result").Array() {
+		capabilities = append(capabilities, c.String())
+	}
+
+	return capabilities, rtt, nil
+}
+
+// watchEngine periodically checks if the Engine API is reachable with our JWT secret.
+func (em ExecutionMonitor) watchEngine() {
+	log := em.Logger
+	cfg := em.Config.Engine
+
+	secret, err := readJWTSecret(cfg.JWTSecret)
+	if err != nil {
+		log.Error().Err(err).Msg("[ENGINE] Not monitoring the Engine API")
+		return
+	}
+
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+
+	log.Info().Str("url", cfg.URL).Str("interval", interval.String()).Msg("[ENGINE] Monitoring the Engine API")
+
+	// Last error, to only alert on changes
+	var last error
+	first := true
+
+	for ; ; time.Sleep(interval) {
+		capabilities, rtt, err := em.EngineCapabilities(secret)
+		if err == nil {
+			metrics.EngineUp.Set(1)
+			metrics.EngineLatency.Set(rtt.Seconds())
+
+			ev := log.Debug()
+			if first || last != nil {
+				ev = log.Info()
+			}
+			ev.Str("latency", rtt.Round(time.Microsecond).String()).Int("capabilities", len(capabilities)).Msg("[ENGINE] Engine API is healthy")
+
+			if last != nil {
+				sendAlert(em.Notifier, log, notify.Alert{
+					Level:   notify.Info,
+					Source:  SourceExecution,
+					Message: "Engine API is healthy again",
+				})
+			}
+
+			last, first = nil, false
+			continue
+		}
+
+		metrics.EngineUp.Set(0)
+
+		msg := "[ENGINE] Engine API unreachable"
+		if errors.Is(err, errJWTRejected) {
+			msg = "[ENGINE] Engine API rejected our JWT"
+		}
+		log.Error().Err(err).Msg(msg)
+
+		if last == nil || last.Error() != err.Error() {
+			sendAlert(em.Notifier, log, notify.Alert{
+				Level:   notify.Critical,
+				Source:  SourceExecution,
+				Message: fmt.Sprintf("%s: %s", strings.TrimPrefix(msg, "[ENGINE] "), err),
+			})
+		}
+
+		last, first = err, false
+	}
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	web "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netbound/e7mon/config"
+)
+
+func TestEngineCapabilities(t *testing.T) {
+	secret := make([]byte, 32)
+	secret[0] = 1
+
+	// Verifies the token like an execution client would
+	srv := httptest.NewServer(web.HandlerFunc(func(w web.ResponseWriter, r *web.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(web.StatusUnauthorized)
+			return
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+			w.WriteHeader(web.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":["engine_newPayloadV1"]}`))
+	}))
+	defer srv.Close()
+
+	em := ExecutionMonitor{Config: &config.ExecutionConfig{Engine: &config.EngineConfig{URL: srv.URL}}}
+
+	capabilities, rtt, err := em.EngineCapabilities(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(capabilities) != 1 || rtt <= 0 || rtt > time.Second {
+		t.Errorf("unexpected response %v in %s", capabilities, rtt)
+	}
+
+	wrong := make([]byte, 32)
+	if _, _, err := em.EngineCapabilities(wrong); err != errJWTRejected {
+		t.Errorf("expected the wrong secret to be rejected, got %v", err)
+	}
+}
@@ -3,12 +3,16 @@ package monitor
 import (
 	"context"
 	"fmt"
+	"math/big"
+	"net/url"
 	"os"
 	"time"
 
 	"github.com/netbound/e7mon/config"
-	"github.com/netbound/e7mon/net"
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/fatih/color"
@@ -17,11 +21,17 @@ import (
 )
 
 type ExecutionMonitor struct {
-	Config  *config.ExecutionConfig
-	Stats   []config.Stat
-	Client  *rpc.Client
-	Logger  zerolog.Logger
-	Scanner *net.Scanner
+	Config        *config.ExecutionConfig
+	Stats         []config.Stat
+	Metrics       *config.MetricsConfig
+	Client        *rpc.Client
+	Logger        zerolog.Logger
+	Notifier      *notify.Dispatcher
+	InterfaceName string
+
+	blocks  *blockStats
+	mev     *mevState
+	scanner *scannerCache
 }
 
 func NewExecutionMonitor() *ExecutionMonitor {
@@ -43,18 +53,60 @@ func NewExecutionMonitor() *ExecutionMonitor {
 		log.Fatal().Msg(err.Error())
 	}
 
+	notifier, err := notify.New(cfg.AlertsConfig)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
 	// TODO: build p2p scanner if latency stat is enabled
 
 	return &ExecutionMonitor{
-		Config: cfg.ExecutionConfig,
-		Stats:  cfg.StatsConfig,
-		Client: client,
-		Logger: log.Output(output),
+		Config:        cfg.ExecutionConfig,
+		Stats:         cfg.StatsConfig,
+		Metrics:       cfg.MetricsConfig,
+		Client:        client,
+		Logger:        log.Output(output),
+		Notifier:      notifier,
+		InterfaceName: cfg.NetConfig.Interface,
+		blocks:        &blockStats{},
+		mev:           &mevState{reported: make(map[common.Hash]bool)},
+		scanner:       &scannerCache{},
 	}
 }
 
+// Block is a header as received from the newHeads subscription.
 type Block struct {
-	Number *hexutil.Big
+	Number     *hexutil.Big   `json:"number"`
+	Hash       common.Hash    `json:"hash"`
+	ParentHash common.Hash    `json:"parentHash"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	GasLimit   hexutil.Uint64 `json:"gasLimit"`
+	// Nil before London
+	BaseFee      *hexutil.Big   `json:"baseFeePerGas"`
+	Timestamp    hexutil.Uint64 `json:"timestamp"`
+	FeeRecipient common.Address `json:"miner"`
+
+	// Not part of the header, fetched separately
+	TxCount uint64 `json:"-"`
+}
+
+// Utilisation returns the gas used as a percentage of the gas limit.
+func (b Block) Utilisation() float64 {
+	if b.GasLimit == 0 {
+		return 0
+	}
+
+	return float64(b.GasUsed) / float64(b.GasLimit) * 100
+}
+
+// BaseFeeGwei returns the base fee in Gwei.
+func (b Block) BaseFeeGwei() float64 {
+	if b.BaseFee == nil {
+		return 0
+	}
+
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(b.BaseFee.ToInt()), big.NewFloat(1e9)).Float64()
+	return f
 }
 
 func (em ExecutionMonitor) Start() {
@@ -69,8 +121,7 @@ func (em ExecutionMonitor) Start() {
 
 	log.Info().Str("api", em.Config.API).Str("node_version", ver).Msg("Starting execution client monitor")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	metrics.Serve(em.Metrics)
 
 	topics, err := parseTopics(em.Stats, em.Config.Settings.StatsConfig.Topics...)
 	if err != nil {
@@ -78,25 +129,167 @@ func (em ExecutionMonitor) Start() {
 	}
 	go em.statLoop(em.Config.Settings.StatsConfig.Interval, topics)
 
-	c := make(chan Block)
-
-	_, err = em.Client.EthSubscribe(ctx, c, "newHeads")
-	if err != nil {
-		log.Fatal().Msg(err.Error())
+	if em.Config.Engine != nil && em.Config.Engine.URL != "" {
+		go em.watchEngine()
 	}
 
 	lastBlock := int64(0)
 	reset := make(chan bool)
+	chain := &headChain{}
 
 	go em.startBlockTimer(reset)
-	for block := range c {
-		tmp := block.Number.ToInt().Int64()
-		if tmp > lastBlock {
+
+	handle := func(block Block) {
+		reorg, isNew, err := em.update(chain, block)
+		if err != nil {
+			log.Error().Err(err).Str("hash", block.Hash.Hex()).Msg("Error checking for reorgs")
+		}
+
+		if reorg != nil {
+			em.reportReorg(reorg)
+		}
+
+		if !isNew {
+			return
+		}
+
+		// Replaced heads at the same height are new blocks too, and after a reorg to a lower
+		// height the new head is the latest block
+		if tmp := block.Number.ToInt().Int64(); tmp >= lastBlock || reorg != nil {
 			lastBlock = tmp
-			log.Info().Int64("block_number", lastBlock).Msg("New execution block")
+
+			block.TxCount, err = em.TxCount(block.Hash)
+			if err != nil {
+				log.Error().Err(err).Int64("block_number", lastBlock).Msg("Error getting transaction count")
+			}
+
+			log.Info().Int64("block_number", lastBlock).
+				Str("hash", block.Hash.TerminalString()).
+				Uint64("txs", block.TxCount).
+				Str("gas", fmt.Sprintf("%d/%d (%.1f%%)", block.GasUsed, block.GasLimit, block.Utilisation())).
+				Str("base_fee", fmt.Sprintf("%.2f gwei", block.BaseFeeGwei())).
+				Str("fee_recipient", block.FeeRecipient.Hex()).
+				Msg("New execution block")
+			metrics.ExecutionBlock(lastBlock)
+			metrics.ExecutionGasUtilisation.Set(block.Utilisation() / 100)
+			metrics.ExecutionBaseFee.Set(block.BaseFeeGwei())
+			metrics.ExecutionTransactions.Set(float64(block.TxCount))
+			em.blocks.Add(block)
+
+			if em.Config.MEV != nil {
+				go func(hash common.Hash) {
+					if err := em.analyseMEV(hash, false); err != nil {
+						log.Error().Err(err).Str("hash", hash.Hex()).Msg("[MEV] Error analysing block")
+					}
+				}(block.Hash)
+			}
 			reset <- true
 		}
 	}
+
+	connect := func(up func()) error {
+		return em.subscribeToHeads(up, handle)
+	}
+
+	// Plain HTTP endpoints can't do subscriptions
+	if u, err := url.Parse(em.Config.API); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		interval := em.Config.Settings.PollInterval
+		if interval == 0 {
+			interval = 2 * time.Second
+		}
+
+		log.Info().Str("interval", interval.String()).Msg("Not a websocket endpoint, polling for new blocks")
+
+		var last uint64
+		connect = func(up func()) error {
+			return em.pollHeads(up, handle, interval, &last)
+		}
+	}
+
+	supervisor{
+		Name:     "Execution client",
+		Source:   SourceExecution,
+		Logger:   log,
+		Notifier: em.Notifier,
+		// No block timer warnings while we know the connection is down
+		OnDown: func() { reset <- false },
+		OnUp:   func() { reset <- true },
+	}.Run(connect)
+}
+
+// subscribeToHeads subscribes to newHeads, and blocks until the subscription fails. The
+// client redials the websocket on the next call after the connection dropped.
+func (em ExecutionMonitor) subscribeToHeads(up func(), handle func(Block)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := make(chan Block)
+	sub, err := em.Client.EthSubscribe(ctx, c, "newHeads")
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	up()
+
+	for {
+		select {
+		case err := <-sub.Err():
+			return err
+		case block := <-c:
+			handle(block)
+		}
+	}
+}
+
+// pollHeads polls for new blocks, and blocks until polling fails. Last is the last block
+// that was handled, kept between reconnects so no heights are skipped.
+func (em ExecutionMonitor) pollHeads(up func(), handle func(Block), interval time.Duration, last *uint64) error {
+	if _, err := BlockNumber(em.Client); err != nil {
+		return err
+	}
+
+	up()
+
+	for ; ; time.Sleep(interval) {
+		head, err := BlockNumber(em.Client)
+		if err != nil {
+			return err
+		}
+
+		from := *last + 1
+		if *last == 0 || head-*last > reorgBufferSize {
+			// Start at head, or we've been away for too long to catch up
+			from = head
+		}
+
+		for n := from; n <= head; n++ {
+			block, err := em.BlockByNumber(n)
+			if err != nil {
+				return err
+			}
+
+			handle(*block)
+			*last = n
+		}
+	}
+}
+
+// BlockByNumber returns the header of the block with number.
+func (em ExecutionMonitor) BlockByNumber(number uint64) (*Block, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var block *Block
+	if err := em.Client.CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.Uint64(number), false); err != nil {
+		return nil, err
+	}
+
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+
+	return block, nil
 }
 
 type BlockTimeLevel struct {
@@ -108,10 +301,18 @@ type BlockTimeLevels [3]*BlockTimeLevel
 
 func (l BlockTimeLevels) Reset() {
 	for _, b := range l {
+		b.Timer.Stop()
 		b.Timer = time.NewTimer(b.Duration)
 	}
 }
 
+// Stop stops the timers until the next reset.
+func (l BlockTimeLevels) Stop() {
+	for _, b := range l {
+		b.Timer.Stop()
+	}
+}
+
 func (em ExecutionMonitor) startBlockTimer(reset <-chan bool) {
 	log := em.Logger
 
@@ -143,16 +344,30 @@ func (em ExecutionMonitor) startBlockTimer(reset <-chan bool) {
 		},
 	}
 
+	warn := func(lvl notify.Level, d time.Duration) {
+		log.Warn().Msgf("%s since last block", d)
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   lvl,
+			Source:  SourceExecution,
+			Message: fmt.Sprintf("%s since last block", d),
+		})
+	}
+
 	for {
 		select {
-		case <-reset:
-			lvls.Reset()
+		case r := <-reset:
+			// False pauses the timers, e.g. while the connection is down
+			if r {
+				lvls.Reset()
+			} else {
+				lvls.Stop()
+			}
 		case <-lvls[0].Timer.C:
-			log.Warn().Msgf("%s since last block", lvls[0].Duration)
+			warn(notify.Info, lvls[0].Duration)
 		case <-lvls[1].Timer.C:
-			log.Warn().Msgf("%s since last block", lvls[1].Duration)
+			warn(notify.Warning, lvls[1].Duration)
 		case <-lvls[2].Timer.C:
-			log.Warn().Msgf("%s since last block", lvls[2].Duration)
+			warn(notify.Critical, lvls[2].Duration)
 		}
 	}
 }
@@ -163,9 +378,11 @@ func parseTopics(stats []config.Stat, topics ...string) (map[string]interface{},
 		for _, stat := range stats {
 			if stat.ID == topic {
 				m[topic] = stat
-				continue
+				break
 			}
+		}
 
+		if _, ok := m[topic]; !ok {
 			return nil, fmt.Errorf("topic '%s' does not exist", topic)
 		}
 	}
@@ -196,6 +413,10 @@ func (em ExecutionMonitor) statLoop(interval time.Duration, topics map[string]in
 
 	log.Info().Strs("topics", getKeys(topics)).Msg("Subscribed to topics")
 
+	sync := &syncState{}
+	txpool := &txpoolState{}
+	peerAlert := &peerCountAlert{Source: SourceExecution}
+
 	for {
 		time.Sleep(interval)
 		if _, ok := topics["p2p"]; ok {
@@ -204,12 +425,34 @@ func (em ExecutionMonitor) statLoop(interval time.Duration, topics map[string]in
 				log.Fatal().Msg(err.Error())
 			}
 
-			if pc < 20 {
+			metrics.ExecutionPeers.Set(float64(pc))
+
+			if alert := peerAlert.Check(int(pc)); alert != nil {
+				sendAlert(em.Notifier, log, *alert)
+			}
+
+			if pc < minPeers {
 				log.Warn().Str("connected", fmt.Sprint(pc)).Msg("[P2P] Low peer count")
 			} else {
 				log.Info().Str("connected", fmt.Sprint(pc)).Msg("[P2P] Network info")
 			}
 		}
+
+		if _, ok := topics["blocks"]; ok {
+			em.blockStat()
+		}
+
+		if _, ok := topics["txpool"]; ok {
+			if err := em.txpoolStat(txpool); err != nil {
+				log.Error().Err(err).Msg("[TXPOOL] Error getting transaction pool status")
+			}
+		}
+
+		if _, ok := topics["sync"]; ok {
+			if err := em.syncStat(sync); err != nil {
+				log.Error().Err(err).Msg("[SYNC] Error getting sync status")
+			}
+		}
 	}
 }
 
@@ -227,6 +470,17 @@ func (em ExecutionMonitor) PeerCount() (uint64, error) {
 	return peerCount.ToInt().Uint64(), nil
 }
 
+// TxCount returns the number of transactions in the block with hash.
+func (em ExecutionMonitor) TxCount(hash common.Hash) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var count hexutil.Uint64
+	err := em.Client.CallContext(ctx, &count, "eth_getBlockTransactionCountByHash", hash)
+
+	return uint64(count), err
+}
+
 func (em ExecutionMonitor) NodeVersion() (version string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -237,7 +491,3 @@ func (em ExecutionMonitor) NodeVersion() (version string, err error) {
 	}
 	return
 }
-
-func (em ExecutionMonitor) P2PStat() {
-
-}
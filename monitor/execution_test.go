@@ -0,0 +1,25 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/netbound/e7mon/config"
+)
+
+func TestParseTopics(t *testing.T) {
+	stats := []config.Stat{{ID: "p2p", Latency: true}, {ID: "blocks"}, {ID: "sync"}}
+
+	// Topics of stats that aren't first in the list
+	topics, err := parseTopics(stats, "sync", "blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(topics) != 2 || topics["sync"].(config.Stat).ID != "sync" || topics["blocks"].(config.Stat).ID != "blocks" {
+		t.Errorf("unexpected topics %v", topics)
+	}
+
+	if _, err := parseTopics(stats, "p2p", "txpool"); err == nil {
+		t.Error("expected an error for an unknown topic")
+	}
+}
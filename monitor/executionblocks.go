@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+)
+
+// blockStats collects the execution blocks received between runs of the blocks stat.
+type blockStats struct {
+	mu     sync.Mutex
+	blocks []Block
+	last   *Block
+}
+
+func (s *blockStats) Add(block Block) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocks = append(s.blocks, block)
+	s.last = &block
+}
+
+// Take returns the blocks received since the last call, and the latest block.
+func (s *blockStats) Take() ([]Block, *Block) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blocks := s.blocks
+	s.blocks = nil
+
+	return blocks, s.last
+}
+
+// blockStat reports the gas utilisation, base fee and transaction trends of the blocks
+// received since the last run.
+func (em ExecutionMonitor) blockStat() {
+	log := em.Logger
+
+	blocks, last := em.blocks.Take()
+	if len(blocks) == 0 {
+		if last == nil {
+			log.Warn().Msg("[BLOCKS] No blocks received yet")
+		} else {
+			log.Warn().Str("last", last.Number.ToInt().String()).Msg("[BLOCKS] No new blocks")
+		}
+		return
+	}
+
+	var (
+		utilisation float64
+		txs         uint64
+		lo, hi      = blocks[0].BaseFeeGwei(), blocks[0].BaseFeeGwei()
+	)
+
+	for _, b := range blocks {
+		utilisation += b.Utilisation()
+		txs += b.TxCount
+
+		if fee := b.BaseFeeGwei(); fee < lo {
+			lo = fee
+		} else if fee > hi {
+			hi = fee
+		}
+	}
+
+	n := float64(len(blocks))
+	first := blocks[0].BaseFeeGwei()
+
+	// Base fee change over the interval
+	trend := 0.0
+	if first > 0 {
+		trend = (last.BaseFeeGwei() - first) / first * 100
+	}
+
+	log.Info().Int("blocks", len(blocks)).
+		Str("head", last.Number.ToInt().String()).
+		Str("avg_gas", fmt.Sprintf("%.1f%%", utilisation/n)).
+		Str("avg_txs", fmt.Sprintf("%.1f", float64(txs)/n)).
+		Str("base_fee", fmt.Sprintf("%.2f gwei", last.BaseFeeGwei())).
+		Str("base_fee_range", fmt.Sprintf("%.2f-%.2f gwei", lo, hi)).
+		Str("base_fee_trend", fmt.Sprintf("%+.1f%%", trend)).
+		Msg("[BLOCKS] Block stats")
+}
@@ -0,0 +1,215 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gonet "net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// ExecutionPeer is a peer as returned by admin_peers.
+type ExecutionPeer struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enode   string `json:"enode"`
+	Network struct {
+		LocalAddress  string `json:"localAddress"`
+		RemoteAddress string `json:"remoteAddress"`
+		Inbound       bool   `json:"inbound"`
+	} `json:"network"`
+	// Protocol info differs per client, and is a string for peers that are still handshaking
+	Protocols map[string]json.RawMessage `json:"protocols"`
+}
+
+// Direction returns whether the peer dialed us or we dialed the peer.
+func (p ExecutionPeer) Direction() string {
+	if p.Network.Inbound {
+		return "inbound"
+	}
+
+	return "outbound"
+}
+
+// Versions returns the versions of the protocols the peer runs, e.g. [eth/68 snap/1].
+func (p ExecutionPeer) Versions() []string {
+	var versions []string
+	for name, info := range p.Protocols {
+		if v := gjson.GetBytes(info, "version"); v.Exists() {
+			versions = append(versions, fmt.Sprintf("%s/%d", name, v.Int()))
+		}
+	}
+	sort.Strings(versions)
+
+	return versions
+}
+
+// Address returns the listening address of the peer from its enode URL, in the format
+// of "ip:port".
+func (p ExecutionPeer) Address() (string, error) {
+	u, err := url.Parse(p.Enode)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Hostname() == "" || u.Port() == "" {
+		return "", fmt.Errorf("no address in enode %s", p.Enode)
+	}
+
+	return gonet.JoinHostPort(u.Hostname(), u.Port()), nil
+}
+
+// Modules returns the RPC namespaces the node exposes, with their versions.
+func (em ExecutionMonitor) Modules() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var modules map[string]string
+	err := em.Client.CallContext(ctx, &modules, "rpc_modules")
+
+	return modules, err
+}
+
+// AdminPeers returns the connected peers, requires the admin namespace.
+func (em ExecutionMonitor) AdminPeers() ([]ExecutionPeer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var peers []ExecutionPeer
+	err := em.Client.CallContext(ctx, &peers, "admin_peers")
+
+	return peers, err
+}
+
+// P2PStat prints the connected peers and their latency. Not every client exposes the
+// admin namespace (e.g. Erigon), in which case only the peer count is printed.
+func (em ExecutionMonitor) P2PStat(iface string) error {
+	log := em.Logger
+
+	var peers []ExecutionPeer
+
+	modules, err := em.Modules()
+	if err != nil {
+		// Not every client implements rpc_modules, try admin_peers anyway
+		log.Debug().Err(err).Msg("Error getting RPC modules")
+		peers, err = em.AdminPeers()
+	} else {
+		names := make([]string, 0, len(modules))
+		for name := range modules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		log.Info().Strs("modules", names).Msg("[P2P] Exposed RPC namespaces")
+
+		if _, ok := modules["admin"]; ok {
+			if peers, err = em.AdminPeers(); err != nil {
+				return err
+			}
+		} else {
+			err = errors.New("admin namespace not exposed")
+		}
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("[P2P] Can't list peers, falling back to the peer count")
+
+		pc, err := em.PeerCount()
+		if err != nil {
+			return err
+		}
+
+		log.Info().Uint64("connected", pc).Msg("[P2P] Network info")
+		return nil
+	}
+
+	var (
+		addrs     []string
+		inbound   int
+		outbound  int
+		byAddress = make(map[string]ExecutionPeer)
+	)
+
+	for _, p := range peers {
+		if p.Network.Inbound {
+			inbound++
+		} else {
+			outbound++
+		}
+
+		log.Info().Str("id", shortID(p.ID)).
+			Str("client", p.Name).
+			Str("direction", p.Direction()).
+			Strs("protocols", p.Versions()).
+			Str("address", p.Network.RemoteAddress).
+			Msg("[P2P] Peer")
+
+		addr, err := p.Address()
+		if err != nil {
+			log.Debug().Err(err).Str("id", shortID(p.ID)).Msg("[P2P] Can't scan peer")
+			continue
+		}
+
+		addrs = append(addrs, addr)
+		byAddress[addr] = p
+	}
+
+	log.Info().Int("connected", len(peers)).Int("inbound", inbound).Int("outbound", outbound).Msg("[P2P] Network info")
+
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	if em.InterfaceName != "" {
+		iface = em.InterfaceName
+	}
+
+	log.Trace().Int("peers", len(addrs)).Msg("[P2P] Starting latency scan")
+	results, err := em.scanner.Get(iface).StartLatencyScan(addrs)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		log.Warn().Int("scanned", len(addrs)).Msg("[P2P] No peers responded to the latency scan")
+		return nil
+	}
+
+	hi := time.Duration(0)
+	lo := time.Duration(1<<63 - 1)
+	var total time.Duration
+	for addr, rtt := range results {
+		if rtt > hi {
+			hi = rtt
+		}
+
+		if rtt < lo {
+			lo = rtt
+		}
+
+		total += rtt
+		log.Debug().Str("id", shortID(byAddress[addr].ID)).Str("address", addr).Str("latency", rtt.String()).Msg("[P2P] Peer latency")
+	}
+
+	avg := (total / time.Duration(len(results))).Round(time.Microsecond)
+
+	log.Info().Str("high", hi.String()).Str("low", lo.String()).Str("avg", avg.String()).Str("response_rate", fmt.Sprintf("%.2f%%", float64(len(results))/float64(len(addrs))*100)).Msg("[P2P] Latency scan results")
+
+	return nil
+}
+
+// shortID shortens a node ID for logging.
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "0x")
+	if len(id) > 16 {
+		return id[:16]
+	}
+
+	return id
+}
@@ -0,0 +1,203 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Number of recent blocks to keep, also the maximum gap in heads that is filled in
+const reorgBufferSize = 64
+
+// Reorg describes a replacement of (part of) our chain.
+type Reorg struct {
+	// Last block both chains have in common
+	Ancestor uint64
+	Depth    uint64
+	OldHead  common.Hash
+	NewHead  common.Hash
+	// Transactions of the old chain that aren't in the new chain
+	Dropped []common.Hash
+}
+
+// headChain keeps a ring buffer of the most recent blocks of the canonical chain by number.
+type headChain struct {
+	blocks [reorgBufferSize]*Block
+	head   *Block
+}
+
+func (c *headChain) get(number uint64) *Block {
+	b := c.blocks[number%reorgBufferSize]
+	if b == nil || b.Number.ToInt().Uint64() != number {
+		return nil
+	}
+
+	return b
+}
+
+func (c *headChain) set(block *Block) {
+	c.blocks[block.Number.ToInt().Uint64()%reorgBufferSize] = block
+}
+
+// blockWithTxs is a block from eth_getBlockByHash with only the transaction hashes.
+type blockWithTxs struct {
+	Block
+	Transactions []common.Hash `json:"transactions"`
+}
+
+// BlockByHash returns the block with hash, including its transaction hashes.
+func (em ExecutionMonitor) BlockByHash(hash common.Hash) (*blockWithTxs, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var block *blockWithTxs
+	if err := em.Client.CallContext(ctx, &block, "eth_getBlockByHash", hash, false); err != nil {
+		return nil, err
+	}
+
+	if block == nil {
+		return nil, fmt.Errorf("block %s not found", hash)
+	}
+
+	return block, nil
+}
+
+// update adds a new head to the chain. It returns a reorg if the head replaces blocks of
+// our chain, and whether the head is new at all.
+func (em ExecutionMonitor) update(c *headChain, block Block) (*Reorg, bool, error) {
+	number := block.Number.ToInt().Uint64()
+
+	if b := c.get(number); b != nil && b.Hash == block.Hash {
+		// Seen this one already
+		return nil, false, nil
+	}
+
+	if c.head == nil || number > c.head.Number.ToInt().Uint64()+reorgBufferSize {
+		// First block, or we've been away for too long to fill the gap
+		*c = headChain{head: &block}
+		c.set(&block)
+		return nil, true, nil
+	}
+
+	head := c.head.Number.ToInt().Uint64()
+
+	// Walk back the new chain until it joins our chain. Heads we missed are filled in.
+	newChain := []*Block{&block}
+	cur := &block
+	var newTxs []common.Hash
+	for n := number; n > 0; n-- {
+		if n-1 <= head {
+			if old := c.get(n - 1); old == nil || old.Hash == cur.ParentHash {
+				break
+			}
+		}
+
+		parent, err := em.BlockByHash(cur.ParentHash)
+		if err != nil {
+			return nil, false, err
+		}
+
+		newTxs = append(newTxs, parent.Transactions...)
+		p := parent.Block
+		p.TxCount = uint64(len(parent.Transactions))
+		newChain = append(newChain, &p)
+		cur = &p
+	}
+
+	ancestor := cur.Number.ToInt().Uint64() - 1
+	if ancestor >= head {
+		for _, b := range newChain {
+			c.set(b)
+		}
+		c.head = &block
+		return nil, true, nil
+	}
+
+	reorg := &Reorg{
+		Ancestor: ancestor,
+		Depth:    head - ancestor,
+		OldHead:  c.head.Hash,
+		NewHead:  block.Hash,
+	}
+
+	// The new head hasn't been fetched with its transactions yet
+	if full, err := em.BlockByHash(block.Hash); err == nil {
+		newTxs = append(newTxs, full.Transactions...)
+	}
+
+	included := make(map[common.Hash]bool, len(newTxs))
+	for _, tx := range newTxs {
+		included[tx] = true
+	}
+
+	for n := ancestor + 1; n <= head; n++ {
+		old := c.get(n)
+		if old == nil {
+			continue
+		}
+
+		// Side chains are kept for a while, so the old blocks can still be fetched
+		full, err := em.BlockByHash(old.Hash)
+		if err != nil {
+			em.Logger.Debug().Err(err).Uint64("block_number", n).Msg("Error getting orphaned block")
+			continue
+		}
+
+		for _, tx := range full.Transactions {
+			if !included[tx] {
+				reorg.Dropped = append(reorg.Dropped, tx)
+			}
+		}
+	}
+
+	// Forget the old blocks above the new head, and replace the rest
+	for n := number + 1; n <= head; n++ {
+		if c.get(n) != nil {
+			c.blocks[n%reorgBufferSize] = nil
+		}
+	}
+
+	for _, b := range newChain {
+		c.set(b)
+	}
+	c.head = &block
+
+	return reorg, true, nil
+}
+
+// reportReorg logs the reorg and sends an alert if it's deeper than the configured depth.
+func (em ExecutionMonitor) reportReorg(reorg *Reorg) {
+	log := em.Logger
+
+	metrics.ExecutionReorgs.Inc()
+	metrics.ExecutionReorgDepth.Observe(float64(reorg.Depth))
+
+	log.Warn().Uint64("depth", reorg.Depth).
+		Uint64("ancestor", reorg.Ancestor).
+		Str("old_head", reorg.OldHead.Hex()).
+		Str("new_head", reorg.NewHead.Hex()).
+		Int("dropped_txs", len(reorg.Dropped)).
+		Msg("Chain reorg")
+
+	for _, tx := range reorg.Dropped {
+		log.Debug().Str("tx", tx.Hex()).Msg("Transaction dropped by reorg")
+	}
+
+	depth := em.Config.Settings.ReorgAlertDepth
+	if depth == 0 {
+		depth = 1
+	}
+
+	if reorg.Depth > depth {
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   notify.Warning,
+			Source:  SourceExecution,
+			Message: fmt.Sprintf("Chain reorg of depth %d at block %d, %d transactions dropped", reorg.Depth, reorg.Ancestor+1, len(reorg.Dropped)),
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/netbound/e7mon/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rs/zerolog"
+)
+
+// fakeEth serves eth_getBlockByHash from a set of blocks.
+type fakeEth struct {
+	blocks map[common.Hash]*blockWithTxs
+}
+
+func (f *fakeEth) GetBlockByHash(hash common.Hash, full bool) *blockWithTxs {
+	return f.blocks[hash]
+}
+
+func TestReorg(t *testing.T) {
+	eth := &fakeEth{blocks: make(map[common.Hash]*blockWithTxs)}
+
+	block := func(number int64, fork byte, parent common.Hash, txs ...common.Hash) Block {
+		b := &blockWithTxs{
+			Block: Block{
+				Number:     (*hexutil.Big)(big.NewInt(number)),
+				Hash:       common.Hash{fork, byte(number)},
+				ParentHash: parent,
+			},
+			Transactions: txs,
+		}
+		eth.blocks[b.Hash] = b
+
+		return b.Block
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+
+	em := ExecutionMonitor{
+		Client: rpc.DialInProc(server),
+		Config: &config.ExecutionConfig{},
+		Logger: zerolog.Nop(),
+	}
+
+	tx1, tx2, tx3 := common.Hash{1}, common.Hash{2}, common.Hash{3}
+
+	a1 := block(1, 0xa, common.Hash{})
+	a2 := block(2, 0xa, a1.Hash)
+	a3 := block(3, 0xa, a2.Hash, tx1)
+	a4 := block(4, 0xa, a3.Hash, tx2)
+	a5 := block(5, 0xa, a4.Hash, tx3)
+
+	b4 := block(4, 0xb, a3.Hash, tx3)
+	b5 := block(5, 0xb, b4.Hash)
+
+	chain := &headChain{}
+
+	// A missed head is filled in
+	for _, b := range []Block{a1, a2, a4, a5} {
+		reorg, isNew, err := em.update(chain, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reorg != nil || !isNew {
+			t.Fatalf("unexpected reorg at block %d", b.Number.ToInt())
+		}
+	}
+
+	if chain.get(3) == nil {
+		t.Fatal("expected block 3 to be filled in")
+	}
+
+	if _, isNew, _ := em.update(chain, a5); isNew {
+		t.Error("expected duplicate head to be ignored")
+	}
+
+	reorg, _, err := em.update(chain, b5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reorg == nil {
+		t.Fatal("expected a reorg")
+	}
+
+	if reorg.Depth != 2 || reorg.Ancestor != 3 || reorg.OldHead != a5.Hash || reorg.NewHead != b5.Hash {
+		t.Errorf("unexpected reorg %+v", reorg)
+	}
+
+	// tx3 was included again in the new chain
+	if len(reorg.Dropped) != 1 || reorg.Dropped[0] != tx2 {
+		t.Errorf("expected tx2 to be dropped, got %v", reorg.Dropped)
+	}
+
+	if chain.get(4).Hash != b4.Hash {
+		t.Error("expected block 4 to be replaced")
+	}
+}
@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// SyncProgress is the result of eth_syncing while the node is syncing.
+type SyncProgress struct {
+	StartingBlock hexutil.Uint64 `json:"startingBlock"`
+	CurrentBlock  hexutil.Uint64 `json:"currentBlock"`
+	HighestBlock  hexutil.Uint64 `json:"highestBlock"`
+}
+
+// syncState is kept between runs of the sync stat.
+type syncState struct {
+	// Last sample, to calculate the sync rate
+	Block uint64
+	Time  time.Time
+
+	Syncing bool
+	Lagging bool
+
+	Reference *rpc.Client
+}
+
+// SyncStatus returns the sync progress, which is nil if the node isn't syncing.
+func (em ExecutionMonitor) SyncStatus() (*SyncProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var raw json.RawMessage
+	if err := em.Client.CallContext(ctx, &raw, "eth_syncing"); err != nil {
+		return nil, err
+	}
+
+	// Returns false when it's not syncing
+	var syncing bool
+	if err := json.Unmarshal(raw, &syncing); err == nil {
+		return nil, nil
+	}
+
+	var progress SyncProgress
+	if err := json.Unmarshal(raw, &progress); err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+// BlockNumber returns the number of the head block of the client.
+func BlockNumber(client *rpc.Client) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var number hexutil.Uint64
+	err := client.CallContext(ctx, &number, "eth_blockNumber")
+
+	return uint64(number), err
+}
+
+// syncStat reports the sync progress of the node, and how far our head trails
+// the reference node.
+func (em ExecutionMonitor) syncStat(state *syncState) error {
+	log := em.Logger
+
+	progress, err := em.SyncStatus()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if progress == nil {
+		metrics.ExecutionSyncing.Set(0)
+		metrics.ExecutionSyncRemaining.Set(0)
+
+		if state.Syncing {
+			log.Info().Msg("[SYNC] Node is synced")
+			sendAlert(em.Notifier, log, notify.Alert{
+				Level:   notify.Info,
+				Source:  SourceExecution,
+				Message: "Node is synced",
+			})
+		}
+		state.Syncing = false
+	} else {
+		current, highest := uint64(progress.CurrentBlock), uint64(progress.HighestBlock)
+
+		var remaining uint64
+		if highest > current {
+			remaining = highest - current
+		}
+
+		metrics.ExecutionSyncing.Set(1)
+		metrics.ExecutionSyncRemaining.Set(float64(remaining))
+
+		ev := log.Warn().
+			Uint64("current", current).
+			Uint64("highest", highest).
+			Uint64("starting", uint64(progress.StartingBlock)).
+			Uint64("remaining", remaining)
+
+		// The rate needs two samples
+		if state.Syncing && current > state.Block {
+			rate := float64(current-state.Block) / now.Sub(state.Time).Seconds()
+			eta := time.Duration(float64(remaining)/rate) * time.Second
+
+			ev = ev.Str("rate", fmt.Sprintf("%.2f blocks/s", rate)).Str("eta", eta.Round(time.Second).String())
+		}
+		ev.Msg("[SYNC] Node is syncing")
+
+		if !state.Syncing {
+			sendAlert(em.Notifier, log, notify.Alert{
+				Level:   notify.Warning,
+				Source:  SourceExecution,
+				Message: fmt.Sprintf("Node is syncing, at block %d of %d", current, highest),
+			})
+		}
+
+		state.Syncing = true
+		state.Block, state.Time = current, now
+	}
+
+	if em.Config.ReferenceAPI == "" {
+		return nil
+	}
+
+	if state.Reference == nil {
+		state.Reference, err = rpc.Dial(em.Config.ReferenceAPI)
+		if err != nil {
+			return fmt.Errorf("connecting to reference node: %w", err)
+		}
+	}
+
+	head, err := BlockNumber(em.Client)
+	if err != nil {
+		return err
+	}
+
+	ref, err := BlockNumber(state.Reference)
+	if err != nil {
+		return fmt.Errorf("reference node: %w", err)
+	}
+
+	var lag uint64
+	if ref > head {
+		lag = ref - head
+	}
+	metrics.ExecutionHeadLag.Set(float64(lag))
+
+	maxLag := em.Config.Settings.MaxHeadLag
+	if maxLag == 0 {
+		maxLag = 3
+	}
+
+	if lag <= maxLag {
+		if state.Lagging {
+			log.Info().Uint64("head", head).Uint64("reference", ref).Msg("[SYNC] Caught up with the reference node")
+		}
+		state.Lagging = false
+
+		log.Debug().Uint64("head", head).Uint64("reference", ref).Uint64("lag", lag).Msg("[SYNC] Head lag")
+		return nil
+	}
+
+	log.Warn().Uint64("head", head).Uint64("reference", ref).Uint64("lag", lag).Msg("[SYNC] Head is trailing the reference node")
+	if !state.Lagging {
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   notify.Warning,
+			Source:  SourceExecution,
+			Message: fmt.Sprintf("Head is trailing the reference node by %d blocks (%d vs %d)", lag, head, ref),
+		})
+	}
+	state.Lagging = true
+
+	return nil
+}
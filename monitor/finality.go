@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/tidwall/gjson"
+)
+
+// watchFinality polls the finality checkpoints every epoch, and escalates warnings when
+// finality lags too far behind the current epoch.
+func (bm BeaconMonitor) watchFinality() {
+	log := bm.Logger
+
+	levels := bm.Config.Settings.FinalityLagLevels
+	if len(levels) != 3 {
+		levels = []uint64{4, 8, 16}
+	}
+
+	// Highest level that was crossed, -1 is healthy
+	level := -1
+
+	for ; ; time.Sleep(bm.spec.EpochDuration()) {
+		res, err := bm.FinalityCheckpoints()
+		if err != nil {
+			log.Error().Err(err).Msg("Error getting finality checkpoints")
+			continue
+		}
+
+		current := uint64(bm.spec.CurrentEpoch())
+		finalized := gjson.Get(res, "finalized.epoch").Uint()
+		justified := gjson.Get(res, "current_justified.epoch").Uint()
+
+		var lag uint64
+		if current > finalized {
+			lag = current - finalized
+		}
+
+		metrics.BeaconFinalizedEpoch.Set(float64(finalized))
+		metrics.BeaconJustifiedEpoch.Set(float64(justified))
+		metrics.BeaconFinalityLag.Set(float64(lag))
+
+		prev := level
+		level = -1
+		for i, l := range levels {
+			if lag >= l {
+				level = i
+			}
+		}
+
+		if level == -1 {
+			if prev != -1 {
+				log.Info().Uint64("epoch", current).Uint64("finalized", finalized).Uint64("lag", lag).Msg("Finality restored")
+				sendAlert(bm.Notifier, log, notify.Alert{
+					Level:   notify.Info,
+					Source:  SourceBeacon,
+					Message: fmt.Sprintf("Finality restored, finalized epoch %d", finalized),
+				})
+			}
+			continue
+		}
+
+		log.Warn().Uint64("epoch", current).Uint64("finalized", finalized).Uint64("justified", justified).Uint64("lag", lag).Msg("Finality lagging")
+
+		// Only alert when escalating
+		if level > prev {
+			sendAlert(bm.Notifier, log, notify.Alert{
+				Level:   thresholdLevels[level],
+				Source:  SourceBeacon,
+				Message: fmt.Sprintf("Finality is lagging %d epochs behind (finalized epoch %d, current epoch %d)", lag, finalized, current),
+			})
+		}
+	}
+}
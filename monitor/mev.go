@@ -0,0 +1,405 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Swap events of Uniswap V2 and V3 style pools, used to find sandwiches
+var swapTopics = map[common.Hash]bool{
+	common.HexToHash("0xd78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822"): true,
+	common.HexToHash("0xc42079f94a6350d7e6235f29174924f928cc2ac818eb64fed8004e115fbcca67"): true,
+}
+
+// Flag coinbase payments of at least this many ETH if no threshold is configured
+const defaultCoinbaseThreshold = 1.0
+
+type mevTx struct {
+	Hash     common.Hash     `json:"hash"`
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Value    *hexutil.Big    `json:"value"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+}
+
+type mevLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+}
+
+type mevReceipt struct {
+	TxHash  common.Hash    `json:"transactionHash"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	// Nil before London
+	EffectiveGasPrice *hexutil.Big `json:"effectiveGasPrice"`
+	Logs              []mevLog     `json:"logs"`
+}
+
+// fullBlock is a block from eth_getBlockByHash with the full transactions.
+type fullBlock struct {
+	Block
+	Transactions []mevTx `json:"transactions"`
+}
+
+// Sandwich is a victim transaction surrounded by two swaps of the same sender in the same pool.
+type Sandwich struct {
+	Pool     common.Address
+	Attacker common.Address
+	Front    common.Hash
+	Victim   common.Hash
+	Back     common.Hash
+}
+
+// MEVReport is the MEV extracted in a block.
+type MEVReport struct {
+	Block Block
+	// Paid to the fee recipient above the base fee, in wei
+	PriorityFees *big.Int
+	// Value sent directly to the fee recipient by the transactions in the block, in wei
+	CoinbaseTransfers *big.Int
+	// Value the fee recipient (usually a builder) sent to our fee recipients, in wei
+	ProposerPayment *big.Int
+	Sandwiches      []Sandwich
+}
+
+// mevState remembers the blocks we reported, as our blocks come in both as heads and
+// through our proposals.
+type mevState struct {
+	mu       sync.Mutex
+	reported map[common.Hash]bool
+	order    []common.Hash
+}
+
+func (s *mevState) markReported(hash common.Hash) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reported[hash] {
+		return false
+	}
+
+	s.reported[hash] = true
+	s.order = append(s.order, hash)
+	if len(s.order) > reorgBufferSize {
+		delete(s.reported, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	return true
+}
+
+// WatchProposal reports the MEV of the execution block of one of our proposals, and
+// verifies the payment of the relay that delivered it. Blocks built by mev-boost builders
+// don't pay to our fee recipient directly, so they can only be recognized this way.
+func (em ExecutionMonitor) WatchProposal(hash common.Hash) {
+	if em.Config.MEV == nil {
+		return
+	}
+
+	if err := em.analyseMEV(hash, true); err != nil {
+		em.Logger.Error().Err(err).Str("hash", hash.Hex()).Msg("[MEV] Error analysing proposed block")
+	}
+
+	if len(em.Config.MEV.Relays) == 0 {
+		return
+	}
+
+	check, err := em.verifyPayload(hash)
+	if err != nil {
+		em.Logger.Error().Err(err).Str("hash", hash.Hex()).Msg("[MEV] Error verifying relay payload")
+		return
+	}
+
+	em.reportPayload(check)
+}
+
+// ourFeeRecipient returns whether the address is one of the configured fee recipients.
+func (em ExecutionMonitor) ourFeeRecipient(addr common.Address) bool {
+	for _, r := range em.Config.MEV.FeeRecipients {
+		if strings.EqualFold(r, addr.Hex()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FullBlock returns the block with hash, including its transactions.
+func (em ExecutionMonitor) FullBlock(hash common.Hash) (*fullBlock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var block *fullBlock
+	if err := em.Client.CallContext(ctx, &block, "eth_getBlockByHash", hash, true); err != nil {
+		return nil, err
+	}
+
+	if block == nil {
+		return nil, fmt.Errorf("block %s not found", hash)
+	}
+
+	return block, nil
+}
+
+// Receipts returns the receipts of the transactions in the block. Clients without
+// eth_getBlockReceipts are asked for every receipt in a batch.
+func (em ExecutionMonitor) Receipts(block *fullBlock) ([]mevReceipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var receipts []mevReceipt
+	err := em.Client.CallContext(ctx, &receipts, "eth_getBlockReceipts", block.Hash)
+	if err == nil && len(receipts) == len(block.Transactions) {
+		return receipts, nil
+	}
+
+	receipts = make([]mevReceipt, len(block.Transactions))
+	batch := make([]rpc.BatchElem, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{tx.Hash},
+			Result: &receipts[i],
+		}
+	}
+
+	if err := em.Client.BatchCallContext(ctx, batch); err != nil {
+		return nil, err
+	}
+
+	for _, elem := range batch {
+		if elem.Error != nil {
+			return nil, elem.Error
+		}
+	}
+
+	return receipts, nil
+}
+
+// analyseMEV computes the MEV of the block and reports it. Ours is true for blocks of
+// our proposals.
+func (em ExecutionMonitor) analyseMEV(hash common.Hash, ours bool) error {
+	block, err := em.FullBlock(hash)
+	if err != nil {
+		return err
+	}
+
+	receipts, err := em.Receipts(block)
+	if err != nil {
+		return err
+	}
+
+	ours = ours || em.ourFeeRecipient(block.FeeRecipient)
+	if ours && !em.mev.markReported(hash) {
+		return nil
+	}
+
+	em.reportMEV(em.mevReport(block, receipts), ours)
+
+	return nil
+}
+
+// mevReport computes the fees and payments to the fee recipient, and looks for sandwiches.
+func (em ExecutionMonitor) mevReport(block *fullBlock, receipts []mevReceipt) *MEVReport {
+	report := &MEVReport{
+		Block:             block.Block,
+		PriorityFees:      new(big.Int),
+		CoinbaseTransfers: new(big.Int),
+		ProposerPayment:   new(big.Int),
+	}
+	report.Block.TxCount = uint64(len(block.Transactions))
+
+	baseFee := new(big.Int)
+	if block.BaseFee != nil {
+		baseFee = block.BaseFee.ToInt()
+	}
+
+	for i, tx := range block.Transactions {
+		r := receipts[i]
+
+		price := tx.GasPrice
+		if r.EffectiveGasPrice != nil {
+			price = r.EffectiveGasPrice
+		}
+
+		if price != nil {
+			tip := new(big.Int).Sub(price.ToInt(), baseFee)
+			if tip.Sign() > 0 {
+				report.PriorityFees.Add(report.PriorityFees, tip.Mul(tip, new(big.Int).SetUint64(uint64(r.GasUsed))))
+			}
+		}
+
+		if tx.To == nil || tx.Value == nil || tx.Value.ToInt().Sign() == 0 {
+			continue
+		}
+
+		switch {
+		case tx.From == block.FeeRecipient:
+			if em.ourFeeRecipient(*tx.To) {
+				report.ProposerPayment.Add(report.ProposerPayment, tx.Value.ToInt())
+			}
+		case *tx.To == block.FeeRecipient:
+			report.CoinbaseTransfers.Add(report.CoinbaseTransfers, tx.Value.ToInt())
+		}
+	}
+
+	report.Sandwiches = findSandwiches(block.Transactions, receipts)
+
+	return report
+}
+
+// findSandwiches looks for swaps in a pool by the same sender, with swaps of other senders
+// in between. A heuristic, the direction of the swaps isn't checked.
+func findSandwiches(txs []mevTx, receipts []mevReceipt) []Sandwich {
+	// Indices of the transactions swapping in each pool, in block order
+	pools := make(map[common.Address][]int)
+	var order []common.Address
+
+	for i, r := range receipts {
+		seen := make(map[common.Address]bool)
+		for _, l := range r.Logs {
+			if len(l.Topics) == 0 || !swapTopics[l.Topics[0]] || seen[l.Address] {
+				continue
+			}
+			seen[l.Address] = true
+
+			if _, ok := pools[l.Address]; !ok {
+				order = append(order, l.Address)
+			}
+			pools[l.Address] = append(pools[l.Address], i)
+		}
+	}
+
+	var sandwiches []Sandwich
+	for _, pool := range order {
+		swaps := pools[pool]
+
+		for a := 0; a < len(swaps); a++ {
+			front := txs[swaps[a]]
+
+			for c := a + 2; c < len(swaps); c++ {
+				back := txs[swaps[c]]
+				if back.From != front.From {
+					continue
+				}
+
+				// The first swap of someone else in between is the victim
+				victim := -1
+				for b := a + 1; b < c; b++ {
+					if txs[swaps[b]].From != front.From {
+						victim = swaps[b]
+						break
+					}
+				}
+
+				// Only swaps of the same sender in between, a later one might be the back-run
+				if victim < 0 {
+					continue
+				}
+
+				sandwiches = append(sandwiches, Sandwich{
+					Pool:     pool,
+					Attacker: front.From,
+					Front:    front.Hash,
+					Victim:   txs[victim].Hash,
+					Back:     back.Hash,
+				})
+				a = c
+				break
+			}
+		}
+	}
+
+	return sandwiches
+}
+
+// reportMEV logs the MEV of our blocks, and flags sandwiches and large coinbase payments.
+func (em ExecutionMonitor) reportMEV(report *MEVReport, ours bool) {
+	log := em.Logger
+	number := report.Block.Number.ToInt().Uint64()
+
+	metrics.ExecutionPriorityFees.Set(weiToEth(report.PriorityFees))
+	metrics.ExecutionCoinbaseTransfers.Set(weiToEth(report.CoinbaseTransfers))
+	metrics.ExecutionSandwiches.Add(float64(len(report.Sandwiches)))
+
+	// Sandwiches are in most blocks, only the ones in our blocks are worth a warning
+	for _, s := range report.Sandwiches {
+		ev := log.Debug()
+		if ours {
+			ev = log.Warn()
+		}
+
+		ev.Uint64("block_number", number).
+			Str("pool", s.Pool.Hex()).
+			Str("attacker", s.Attacker.Hex()).
+			Str("victim_tx", s.Victim.Hex()).
+			Msg("[MEV] Sandwich")
+	}
+
+	if ours {
+		reward := new(big.Int).Add(report.PriorityFees, report.CoinbaseTransfers)
+		if report.ProposerPayment.Sign() > 0 {
+			// Built by someone else, the payment is what we get
+			reward = report.ProposerPayment
+		}
+
+		log.Info().Uint64("block_number", number).
+			Str("fee_recipient", report.Block.FeeRecipient.Hex()).
+			Str("priority_fees", formatEth(report.PriorityFees)).
+			Str("coinbase_transfers", formatEth(report.CoinbaseTransfers)).
+			Str("proposer_payment", formatEth(report.ProposerPayment)).
+			Int("sandwiches", len(report.Sandwiches)).
+			Msg("[MEV] Our block")
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   notify.Info,
+			Source:  SourceExecution,
+			Message: fmt.Sprintf("Our block %d earned %s", number, formatEth(reward)),
+		})
+
+		if len(report.Sandwiches) > 0 {
+			sendAlert(em.Notifier, log, notify.Alert{
+				Level:   notify.Warning,
+				Source:  SourceExecution,
+				Message: fmt.Sprintf("Our block %d contains %d sandwiches", number, len(report.Sandwiches)),
+			})
+		}
+		return
+	}
+
+	threshold := em.Config.MEV.CoinbaseThreshold
+	if threshold == 0 {
+		threshold = defaultCoinbaseThreshold
+	}
+
+	if transfers := weiToEth(report.CoinbaseTransfers); transfers >= threshold {
+		log.Warn().Uint64("block_number", number).
+			Str("fee_recipient", report.Block.FeeRecipient.Hex()).
+			Str("coinbase_transfers", formatEth(report.CoinbaseTransfers)).
+			Msg("[MEV] Large coinbase payment")
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   notify.Info,
+			Source:  SourceExecution,
+			Message: fmt.Sprintf("Block %d paid %s directly to its fee recipient", number, formatEth(report.CoinbaseTransfers)),
+		})
+	}
+}
+
+func weiToEth(wei *big.Int) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18)).Float64()
+	return f
+}
+
+func formatEth(wei *big.Int) string {
+	return fmt.Sprintf("%.4f ETH", weiToEth(wei))
+}
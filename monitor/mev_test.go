@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestFindSandwiches(t *testing.T) {
+	v2Swap := common.HexToHash("0xd78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822")
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+	pool, other := common.Address{0xaa}, common.Address{0xbb}
+	bot, alice, bob := common.Address{1}, common.Address{2}, common.Address{3}
+
+	var (
+		txs      []mevTx
+		receipts []mevReceipt
+	)
+
+	add := func(from common.Address, logs ...mevLog) {
+		hash := common.Hash{byte(len(txs) + 1)}
+		txs = append(txs, mevTx{Hash: hash, From: from})
+		receipts = append(receipts, mevReceipt{TxHash: hash, Logs: logs})
+	}
+
+	swap := func(p common.Address) mevLog {
+		return mevLog{Address: p, Topics: []common.Hash{v2Swap}}
+	}
+
+	add(bot, swap(pool))                                               // 1: front
+	add(alice, mevLog{Address: pool, Topics: []common.Hash{transfer}}) // 2: no swap
+	add(alice, swap(pool))                                             // 3: victim
+	add(bob, swap(other))                                              // 4: other pool
+	add(bot, swap(pool))                                               // 5: back
+	add(bob, swap(other))                                              // 6: same sender, nobody in between
+
+	sandwiches := findSandwiches(txs, receipts)
+	if len(sandwiches) != 1 {
+		t.Fatalf("expected 1 sandwich, got %d", len(sandwiches))
+	}
+
+	s := sandwiches[0]
+	if s.Pool != pool || s.Attacker != bot || s.Front != txs[0].Hash || s.Victim != txs[2].Hash || s.Back != txs[4].Hash {
+		t.Errorf("unexpected sandwich %+v", s)
+	}
+
+	// Front-run split over several swaps, the back-run comes after the victim
+	txs, receipts = nil, nil
+	add(bot, swap(pool))   // 1: front
+	add(bot, swap(pool))   // 2: front
+	add(bot, swap(pool))   // 3: front
+	add(alice, swap(pool)) // 4: victim
+	add(bot, swap(pool))   // 5: back
+
+	sandwiches = findSandwiches(txs, receipts)
+	if len(sandwiches) != 1 {
+		t.Fatalf("expected 1 sandwich, got %d", len(sandwiches))
+	}
+
+	s = sandwiches[0]
+	if s.Front != txs[0].Hash || s.Victim != txs[3].Hash || s.Back != txs[4].Hash {
+		t.Errorf("unexpected sandwich %+v", s)
+	}
+}
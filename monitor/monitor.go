@@ -1,13 +1,43 @@
 package monitor
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	web "net/http"
 	"os"
+	"sync"
 
 	"github.com/netbound/e7mon/config"
+	"github.com/netbound/e7mon/net"
+	"github.com/netbound/e7mon/notify"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/tidwall/gjson"
 )
 
+// Alert sources
+const (
+	SourceExecution = "EXECUTION"
+	SourceBeacon    = "BEACON"
+	SourceValidator = "VALIDATOR"
+)
+
+// scannerCache creates the latency scanner on first use and keeps it, as finding the
+// gateways with ARP and NDP is slow.
+type scannerCache struct {
+	once    sync.Once
+	scanner *net.Scanner
+}
+
+func (c *scannerCache) Get(iface string) *net.Scanner {
+	c.once.Do(func() {
+		c.scanner = net.NewScanner(iface)
+	})
+
+	return c.scanner
+}
+
 type Monitor struct {
 	Config    *config.Config
 	Execution *ExecutionMonitor
@@ -24,6 +54,9 @@ func NewMonitor() *Monitor {
 	exec := NewExecutionMonitor()
 	consensus := NewBeaconMonitor()
 	validator := NewValidatorMonitor()
+	validator.Follow(consensus)
+	validator.OnProposal(exec.WatchProposal)
+	consensus.OnReorg(validator.HandleReorg)
 
 	return &Monitor{
 		Config:    cfg,
@@ -57,3 +90,92 @@ func (m Monitor) PrintVersions() {
 	}
 	fmt.Printf("Beacon client version:\t\t%s\n", beaconVersion)
 }
+
+// Alert levels of the three thresholds of the level settings, e.g. reorg_depth_levels
+var thresholdLevels = []notify.Level{notify.Info, notify.Warning, notify.Critical}
+
+// Peer count below which the P2P stat warns
+const minPeers = 20
+
+// peerCountAlert only alerts when the peer count drops below minPeers, and when it recovers.
+type peerCountAlert struct {
+	Source string
+	low    bool
+}
+
+// Check returns the alert to send for the peer count, if any.
+func (a *peerCountAlert) Check(connected int) *notify.Alert {
+	low := connected < minPeers
+	if low == a.low {
+		return nil
+	}
+	a.low = low
+
+	if low {
+		return &notify.Alert{
+			Level:   notify.Warning,
+			Source:  a.Source,
+			Message: fmt.Sprintf("Low peer count: %d connected", connected),
+		}
+	}
+
+	return &notify.Alert{
+		Level:   notify.Info,
+		Source:  a.Source,
+		Message: fmt.Sprintf("Peer count recovered: %d connected", connected),
+	}
+}
+
+// sendAlert sends out the alert without blocking the caller, errors are logged.
+func sendAlert(n notify.Notifier, logger zerolog.Logger, alert notify.Alert) {
+	go func() {
+		if err := n.Notify(alert); err != nil {
+			logger.Error().Err(err).Msg("Failed to send alert")
+		}
+	}()
+}
+
+// getJSON does a GET request and returns the response body. If the resource
+// doesn't exist (e.g. a block in a missed slot), the body is nil.
+func getJSON(url string) ([]byte, error) {
+	res, err := web.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == web.StatusNotFound {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != web.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s %s", url, res.Status, gjson.GetBytes(body, "message").String())
+	}
+
+	return body, nil
+}
+
+// postJSON does a POST request with a JSON body and returns the response body.
+func postJSON(url string, body string) ([]byte, error) {
+	res, err := web.Post(url, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != web.StatusOK {
+		return nil, fmt.Errorf("POST %s: %s %s", url, res.Status, gjson.GetBytes(data, "message").String())
+	}
+
+	return data, nil
+}
@@ -0,0 +1,34 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/netbound/e7mon/notify"
+)
+
+func TestPeerCountAlert(t *testing.T) {
+	for _, source := range []string{SourceBeacon, SourceExecution} {
+		a := &peerCountAlert{Source: source}
+
+		if alert := a.Check(50); alert != nil {
+			t.Errorf("%s: unexpected alert with enough peers: %+v", source, alert)
+		}
+
+		if alert := a.Check(10); alert == nil || alert.Level != notify.Warning || alert.Source != source {
+			t.Errorf("%s: expected a low peer count warning, got %+v", source, alert)
+		}
+
+		// Still low, already alerted
+		if alert := a.Check(5); alert != nil {
+			t.Errorf("%s: expected a single alert, got %+v", source, alert)
+		}
+
+		if alert := a.Check(25); alert == nil || alert.Level != notify.Info {
+			t.Errorf("%s: expected a recovery alert, got %+v", source, alert)
+		}
+
+		if alert := a.Check(30); alert != nil {
+			t.Errorf("%s: unexpected alert after recovery: %+v", source, alert)
+		}
+	}
+}
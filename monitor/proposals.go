@@ -0,0 +1,302 @@
+package monitor
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/netbound/e7mon/notify"
+
+	api "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/tidwall/gjson"
+)
+
+type proposal struct {
+	Duty *api.ProposerDuty
+	// Root of the block we saw for this slot, nil until it's received
+	Root *phase0.Root
+	// Countdown thresholds that were logged already
+	countdown int
+}
+
+// Follow makes the validator monitor use the block events of the beacon monitor,
+// instead of subscribing to the event stream itself. Has to be called before starting
+// the beacon monitor.
+func (vm *ValidatorMonitor) Follow(bm *BeaconMonitor) {
+	bm.OnBlock(vm.HandleBlock)
+	vm.following = true
+}
+
+// OnProposal registers a handler that is called with the execution block hash of every
+// block we proposed. Has to be called before starting the monitor.
+func (vm *ValidatorMonitor) OnProposal(handler func(common.Hash)) {
+	vm.proposalHandlers = append(vm.proposalHandlers, handler)
+}
+
+// HandleBlock confirms our proposals when their block comes in.
+func (vm *ValidatorMonitor) HandleBlock(block *api.BlockEvent) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	p, ok := vm.proposals[block.Slot]
+	if !ok || p.Root != nil {
+		return
+	}
+
+	root := block.Block
+	p.Root = &root
+	go vm.reportProposal(p)
+}
+
+func (vm *ValidatorMonitor) subscribeToBlocks() {
+	handler := func(event *api.Event) {
+		if block, ok := event.Data.(*api.BlockEvent); ok {
+			vm.HandleBlock(block)
+		}
+	}
+
+	supervisor{
+		Name:     "Beacon node",
+		Source:   SourceValidator,
+		Logger:   vm.Logger,
+		Notifier: vm.Notifier,
+	}.Run(func(up func()) error {
+		return streamEvents(vm.Logger, vm.API, []string{"block"}, handler, up)
+	})
+}
+
+// trackProposals keeps track of the proposer duties of the current and next epoch, and
+// checks if the proposals made it into the canonical chain.
+func (vm *ValidatorMonitor) trackProposals() {
+	log := vm.Logger
+
+	var epoch phase0.Epoch
+	first := true
+
+	for ; ; time.Sleep(vm.spec.SlotDuration) {
+		slot := vm.spec.CurrentSlot()
+
+		if current := vm.spec.Epoch(slot); first || current > epoch {
+			for _, e := range []phase0.Epoch{current, current + 1} {
+				duties, err := vm.proposerDuties(e)
+				if err != nil {
+					// Not all nodes return the duties of the next epoch
+					log.Debug().Err(err).Uint64("epoch", uint64(e)).Msg("Error getting proposer duties")
+					continue
+				}
+
+				vm.addProposals(duties, slot)
+			}
+
+			first = false
+			epoch = current
+		}
+
+		vm.countdownProposals()
+		vm.checkProposals(slot)
+	}
+}
+
+// proposalThresholds returns the times before a proposal at which the countdown is logged,
+// longest first.
+func (vm *ValidatorMonitor) proposalThresholds() []time.Duration {
+	return []time.Duration{vm.spec.EpochDuration(), time.Minute, vm.spec.SlotDuration}
+}
+
+// passedThresholds returns how many of the thresholds the remaining time is within.
+func passedThresholds(remaining time.Duration, thresholds []time.Duration) int {
+	n := 0
+	for _, t := range thresholds {
+		if remaining <= t {
+			n++
+		}
+	}
+
+	return n
+}
+
+// countdownProposals logs the time left until our upcoming proposals, once for every
+// threshold that's crossed.
+func (vm *ValidatorMonitor) countdownProposals() {
+	log := vm.Logger
+	thresholds := vm.proposalThresholds()
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	for s, p := range vm.proposals {
+		remaining := time.Until(vm.spec.SlotStart(s))
+		if p.Root != nil || remaining < 0 {
+			continue
+		}
+
+		if n := passedThresholds(remaining, thresholds); n > p.countdown {
+			p.countdown = n
+			log.Info().Uint64("validator_index", uint64(p.Duty.ValidatorIndex)).
+				Uint64("slot", uint64(s)).
+				Str("in", remaining.Round(time.Second).String()).
+				Msg("Block proposal coming up")
+		}
+	}
+}
+
+func (vm *ValidatorMonitor) addProposals(duties []*api.ProposerDuty, slot phase0.Slot) {
+	log := vm.Logger
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	for _, duty := range duties {
+		// Too late to follow these
+		if duty.Slot < slot {
+			continue
+		}
+
+		// Announced already
+		if _, ok := vm.proposals[duty.Slot]; ok {
+			continue
+		}
+
+		remaining := time.Until(vm.spec.SlotStart(duty.Slot))
+		vm.proposals[duty.Slot] = &proposal{
+			Duty: duty,
+			// No countdown for the thresholds we're within already
+			countdown: passedThresholds(remaining, vm.proposalThresholds()),
+		}
+
+		log.Info().Uint64("validator_index", uint64(duty.ValidatorIndex)).
+			Uint64("slot", uint64(duty.Slot)).
+			Str("in", remaining.Round(time.Second).String()).
+			Msg("Upcoming block proposal")
+	}
+}
+
+// checkProposals flags proposals that weren't received, or that were orphaned later. The
+// chain is checked without holding the lock, so a slow node doesn't block the block events.
+func (vm *ValidatorMonitor) checkProposals(slot phase0.Slot) {
+	log := vm.Logger
+
+	// Proposals to check, with the root we had when starting
+	due := make(map[phase0.Slot]*phase0.Root)
+
+	vm.mu.Lock()
+	for s, p := range vm.proposals {
+		if (p.Root == nil && slot > s+1) || (p.Root != nil && uint64(slot) >= uint64(s)+vm.spec.SlotsPerEpoch) {
+			due[s] = p.Root
+		}
+	}
+	vm.mu.Unlock()
+
+	for s, expected := range due {
+		root, found, err := vm.canonicalRoot(s)
+		if err != nil {
+			log.Error().Err(err).Msg("Error getting block header")
+			continue
+		}
+
+		vm.mu.Lock()
+		p, ok := vm.proposals[s]
+		// Handled in the meantime
+		if !ok || p.Root != expected {
+			vm.mu.Unlock()
+			continue
+		}
+
+		switch {
+		case expected == nil && found:
+			// We missed the event
+			p.Root = &root
+			go vm.reportProposal(p)
+		case expected == nil:
+			log.Error().Uint64("validator_index", uint64(p.Duty.ValidatorIndex)).Uint64("slot", uint64(s)).Msg("MISSED BLOCK PROPOSAL")
+			sendAlert(vm.Notifier, log, notify.Alert{
+				Level:   notify.Critical,
+				Source:  SourceValidator,
+				Message: fmt.Sprintf("Validator %d missed its block proposal in slot %d", p.Duty.ValidatorIndex, s),
+			})
+			delete(vm.proposals, s)
+		default:
+			if !found || root != *expected {
+				log.Error().Uint64("validator_index", uint64(p.Duty.ValidatorIndex)).Uint64("slot", uint64(s)).Str("root", fmt.Sprintf("%#x", *expected)).Msg("ORPHANED BLOCK PROPOSAL")
+				sendAlert(vm.Notifier, log, notify.Alert{
+					Level:   notify.Critical,
+					Source:  SourceValidator,
+					Message: fmt.Sprintf("Block proposed by validator %d in slot %d was orphaned", p.Duty.ValidatorIndex, s),
+				})
+			}
+			delete(vm.proposals, s)
+		}
+		vm.mu.Unlock()
+	}
+}
+
+func (vm *ValidatorMonitor) reportProposal(p *proposal) {
+	log := vm.Logger
+
+	body, err := getJSON(fmt.Sprintf("%s/eth/v2/beacon/blocks/%#x", vm.API, *p.Root))
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting proposed block")
+		return
+	}
+
+	block := gjson.GetBytes(body, "data.message")
+	proposer := block.Get("proposer_index").Uint()
+
+	ev := log.Info()
+	if proposer != uint64(p.Duty.ValidatorIndex) {
+		ev = log.Warn()
+	}
+
+	epoch := vm.spec.Epoch(p.Duty.Slot)
+	ev = ev.Uint64("validator_index", uint64(p.Duty.ValidatorIndex)).
+		Uint64("proposer_index", proposer).
+		Uint64("slot", uint64(p.Duty.Slot)).
+		Str("fork", vm.spec.ForkAt(epoch).Name).
+		Str("graffiti", parseGraffiti(block.Get("body.graffiti").String())).
+		Int64("attestations", block.Get("body.attestations.#").Int())
+
+	// Blocks only contain an execution payload since the merge
+	if vm.spec.Active(ForkBellatrix, epoch) {
+		ev = ev.Int64("txs", block.Get("body.execution_payload.transactions.#").Int())
+	}
+
+	ev.Msg("Block proposed")
+
+	if hash := block.Get("body.execution_payload.block_hash"); hash.Exists() && proposer == uint64(p.Duty.ValidatorIndex) {
+		for _, handler := range vm.proposalHandlers {
+			handler(common.HexToHash(hash.String()))
+		}
+	}
+}
+
+// canonicalRoot returns the root of the canonical block at slot, found is false if the slot is empty.
+func (vm *ValidatorMonitor) canonicalRoot(slot phase0.Slot) (root phase0.Root, found bool, err error) {
+	body, err := getJSON(fmt.Sprintf("%s/eth/v1/beacon/headers/%d", vm.API, slot))
+	if err != nil || body == nil {
+		return
+	}
+
+	root, err = parseRoot(gjson.GetBytes(body, "data.root").String())
+	return root, err == nil, err
+}
+
+func (vm *ValidatorMonitor) proposerDuties(epoch phase0.Epoch) ([]*api.ProposerDuty, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return vm.Client.ProposerDuties(ctx, epoch, vm.Indices)
+}
+
+// parseGraffiti decodes the hex encoded graffiti, which is right padded with zero bytes.
+func parseGraffiti(s string) string {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return s
+	}
+
+	return strings.TrimRight(string(b), "\x00")
+}
@@ -0,0 +1,211 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tidwall/gjson"
+)
+
+// RelayBid is a payload a relay delivered to a proposer, from its data API.
+type RelayBid struct {
+	Relay         string
+	Slot          uint64
+	BuilderPubkey string
+	FeeRecipient  common.Address
+	// Promised to the fee recipient, in wei
+	Value *big.Int
+}
+
+// payloadCheck is the result of verifying the payload of one of our blocks.
+type payloadCheck struct {
+	Number uint64
+	Hash   common.Hash
+	// Nil if no relay delivered the block, so it was built locally
+	Bid *RelayBid
+	// Paid to the fee recipient by the builder, or its balance change in the block if there
+	// is no payment transaction, in wei
+	Received *big.Int
+}
+
+// Mismatch returns whether the fee recipient received less than the relay promised.
+func (c payloadCheck) Mismatch() bool {
+	return c.Bid != nil && c.Received.Cmp(c.Bid.Value) < 0
+}
+
+// relayHost returns the relay URL without the public key, for requests and logging.
+func relayHost(relay string) (string, error) {
+	u, err := url.Parse(relay)
+	if err != nil {
+		return "", err
+	}
+	u.User = nil
+
+	return u.String(), nil
+}
+
+// RelayPayload returns the payload the relay delivered for the block with hash, or nil
+// if it didn't deliver it.
+func RelayPayload(relay string, hash common.Hash) (*RelayBid, error) {
+	host, err := relayHost(relay)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := getJSON(fmt.Sprintf("%s/relay/v1/data/bidtraces/proposer_payload_delivered?block_hash=%s", host, hash.Hex()))
+	if err != nil || body == nil {
+		return nil, err
+	}
+
+	for _, trace := range gjson.ParseBytes(body).Array() {
+		if common.HexToHash(trace.Get("block_hash").String()) != hash {
+			continue
+		}
+
+		value, ok := new(big.Int).SetString(trace.Get("value").String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid value %q from %s", trace.Get("value").String(), host)
+		}
+
+		return &RelayBid{
+			Relay:         host,
+			Slot:          trace.Get("slot").Uint(),
+			BuilderPubkey: trace.Get("builder_pubkey").String(),
+			FeeRecipient:  common.HexToAddress(trace.Get("proposer_fee_recipient").String()),
+			Value:         value,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// BalanceChange returns the change in balance of the address in the block with number.
+func (em ExecutionMonitor) BalanceChange(addr common.Address, number uint64) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var before, after hexutil.Big
+	if err := em.Client.CallContext(ctx, &before, "eth_getBalance", addr, hexutil.Uint64(number-1)); err != nil {
+		return nil, err
+	}
+
+	if err := em.Client.CallContext(ctx, &after, "eth_getBalance", addr, hexutil.Uint64(number)); err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).Sub(after.ToInt(), before.ToInt()), nil
+}
+
+// builderPayment returns the value of the last transaction of the block from the builder
+// (the block's fee recipient) to recipient, which is how builders pay the proposer. Nil if
+// there is none.
+func builderPayment(block *fullBlock, recipient common.Address) *big.Int {
+	if block.FeeRecipient == recipient {
+		return nil
+	}
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		if tx.From == block.FeeRecipient && tx.To != nil && *tx.To == recipient && tx.Value != nil {
+			return new(big.Int).Set(tx.Value.ToInt())
+		}
+	}
+
+	return nil
+}
+
+// verifyPayload finds the relay that delivered the block, and checks the payment to the
+// fee recipient against the value it promised.
+func (em ExecutionMonitor) verifyPayload(hash common.Hash) (*payloadCheck, error) {
+	block, err := em.FullBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &payloadCheck{Number: block.Number.ToInt().Uint64(), Hash: hash}
+
+	var failed int
+	for _, relay := range em.Config.MEV.Relays {
+		bid, err := RelayPayload(relay, hash)
+		if err != nil {
+			em.Logger.Error().Err(err).Msg("[MEV] Error getting delivered payloads from relay")
+			failed++
+			continue
+		}
+
+		if bid != nil {
+			check.Bid = bid
+			break
+		}
+	}
+
+	if check.Bid == nil {
+		// We can't tell if the block was built locally if a relay didn't answer
+		if failed > 0 {
+			return nil, fmt.Errorf("block not found in %d relays, %d relays unreachable", len(em.Config.MEV.Relays)-failed, failed)
+		}
+		return check, nil
+	}
+
+	if check.Received = builderPayment(block, check.Bid.FeeRecipient); check.Received != nil {
+		return check, nil
+	}
+
+	// Transactions of the fee recipient in the block skew its balance change, so this is
+	// only a fallback
+	check.Received, err = em.BalanceChange(check.Bid.FeeRecipient, check.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	return check, nil
+}
+
+// reportPayload logs the result of the payload verification, and sends an alert if the
+// relay didn't pay what it promised or the block was built locally.
+func (em ExecutionMonitor) reportPayload(check *payloadCheck) {
+	log := em.Logger
+
+	if check.Bid == nil {
+		metrics.RelayPayloads.WithLabelValues("local").Inc()
+
+		log.Warn().Uint64("block_number", check.Number).Str("hash", check.Hash.Hex()).Msg("[MEV] Our block was built locally")
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   notify.Warning,
+			Source:  SourceExecution,
+			Message: fmt.Sprintf("Our block %d wasn't delivered by any relay, it was built locally", check.Number),
+		})
+		return
+	}
+
+	ev := log.Info()
+	if check.Mismatch() {
+		metrics.RelayPayloads.WithLabelValues("mismatch").Inc()
+		ev = log.Error()
+	} else {
+		metrics.RelayPayloads.WithLabelValues("verified").Inc()
+	}
+
+	ev.Uint64("block_number", check.Number).
+		Str("relay", check.Bid.Relay).
+		Str("fee_recipient", check.Bid.FeeRecipient.Hex()).
+		Str("promised", formatEth(check.Bid.Value)).
+		Str("received", formatEth(check.Received)).
+		Msg("[MEV] Relay payload")
+
+	if check.Mismatch() {
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   notify.Critical,
+			Source:  SourceExecution,
+			Message: fmt.Sprintf("Relay %s promised %s for our block %d, but the fee recipient received %s", check.Bid.Relay, formatEth(check.Bid.Value), check.Number, formatEth(check.Received)),
+		})
+	}
+}
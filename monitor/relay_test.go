@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"fmt"
+	"math/big"
+	web "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netbound/e7mon/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rs/zerolog"
+)
+
+// fakeBalances serves eth_getBalance by block number.
+type fakeBalances struct {
+	balances map[uint64]*big.Int
+}
+
+func (f *fakeBalances) GetBalance(addr common.Address, number hexutil.Uint64) *hexutil.Big {
+	return (*hexutil.Big)(f.balances[uint64(number)])
+}
+
+// fakeFullBlocks serves eth_getBlockByHash with the full transactions.
+type fakeFullBlocks struct {
+	blocks map[common.Hash]*fullBlock
+}
+
+func (f *fakeFullBlocks) GetBlockByHash(hash common.Hash, full bool) *fullBlock {
+	return f.blocks[hash]
+}
+
+func TestVerifyPayload(t *testing.T) {
+	hash, local, paid := common.Hash{1}, common.Hash{2}, common.Hash{3}
+	recipient, builder := common.Address{0xfe}, common.Address{0xb0}
+
+	// Stand-in relay that delivered the first block
+	relay := httptest.NewServer(web.HandlerFunc(func(w web.ResponseWriter, r *web.Request) {
+		if r.URL.Path != "/relay/v1/data/bidtraces/proposer_payload_delivered" {
+			w.WriteHeader(web.StatusNotFound)
+			return
+		}
+
+		delivered := r.URL.Query().Get("block_hash")
+		if delivered != hash.Hex() && delivered != paid.Hex() {
+			w.Write([]byte(`[]`))
+			return
+		}
+
+		fmt.Fprintf(w, `[{"slot":"100","block_hash":"%s","builder_pubkey":"0xb0","proposer_fee_recipient":"%s","value":"1000000000000000000"}]`, delivered, recipient.Hex())
+	}))
+	defer relay.Close()
+
+	other := common.Address{0x01}
+	eth := &fakeFullBlocks{blocks: map[common.Hash]*fullBlock{
+		hash:  {Block: Block{Number: (*hexutil.Big)(big.NewInt(10)), Hash: hash, FeeRecipient: builder}},
+		local: {Block: Block{Number: (*hexutil.Big)(big.NewInt(11)), Hash: local}},
+		// The builder pays in full, but the fee recipient sends 0.5 ETH away in the same block
+		paid: {
+			Block: Block{Number: (*hexutil.Big)(big.NewInt(12)), Hash: paid, FeeRecipient: builder},
+			Transactions: []mevTx{
+				{From: recipient, To: &other, Value: (*hexutil.Big)(big.NewInt(5e17))},
+				{From: builder, To: &recipient, Value: (*hexutil.Big)(big.NewInt(1e18))},
+			},
+		},
+	}}
+	balances := &fakeBalances{balances: map[uint64]*big.Int{
+		9:  big.NewInt(5e18),
+		10: big.NewInt(5.9e18),
+		11: big.NewInt(5.9e18),
+		12: big.NewInt(6.4e18),
+	}}
+
+	server := rpc.NewServer()
+	for _, service := range []interface{}{eth, balances} {
+		if err := server.RegisterName("eth", service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	em := ExecutionMonitor{
+		Client: rpc.DialInProc(server),
+		Config: &config.ExecutionConfig{MEV: &config.MEVConfig{Relays: []string{relay.URL}}},
+		Logger: zerolog.Nop(),
+	}
+
+	check, err := em.verifyPayload(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if check.Bid == nil || check.Bid.Slot != 100 || check.Bid.FeeRecipient != recipient {
+		t.Fatalf("unexpected bid %+v", check.Bid)
+	}
+
+	// No payment transaction, 0.9 ETH balance change and 1 ETH promised
+	if !check.Mismatch() {
+		t.Errorf("expected a mismatch, received %s", check.Received)
+	}
+
+	check, err = em.verifyPayload(paid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if check.Mismatch() || check.Received.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("expected the 1 ETH payment, received %s", check.Received)
+	}
+
+	check, err = em.verifyPayload(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if check.Bid != nil {
+		t.Errorf("expected a locally built block, got %+v", check.Bid)
+	}
+}
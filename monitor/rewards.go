@@ -0,0 +1,224 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/tidwall/gjson"
+)
+
+// Rewards that are paid out per block, in Gwei
+type blockRewards struct {
+	Proposal      int64
+	SyncCommittee int64
+}
+
+type rewards struct {
+	// Epoch at which the balances were sampled
+	Epoch    phase0.Epoch
+	Balances map[phase0.ValidatorIndex]uint64
+	Sampled  bool
+
+	Blocks map[phase0.Epoch]*blockRewards
+	// Total balance deltas of the last week, most recent last
+	History      []int64
+	EpochsPerDay int
+}
+
+func newRewards(epochsPerDay int) *rewards {
+	return &rewards{
+		Blocks:       make(map[phase0.Epoch]*blockRewards),
+		EpochsPerDay: epochsPerDay,
+	}
+}
+
+func (r *rewards) block(epoch phase0.Epoch) *blockRewards {
+	if _, ok := r.Blocks[epoch]; !ok {
+		r.Blocks[epoch] = &blockRewards{}
+	}
+
+	return r.Blocks[epoch]
+}
+
+func (r *rewards) add(delta int64) {
+	r.History = append(r.History, delta)
+	if len(r.History) > 7*r.EpochsPerDay {
+		r.History = r.History[1:]
+	}
+}
+
+// Totals returns the sum of the deltas of the last day and week.
+func (r *rewards) Totals() (day, week int64) {
+	for i, d := range r.History {
+		if i >= len(r.History)-r.EpochsPerDay {
+			day += d
+		}
+		week += d
+	}
+
+	return
+}
+
+// collectBlockRewards collects the proposal and sync committee rewards of a block.
+func (vm *ValidatorMonitor) collectBlockRewards(block gjson.Result, slot phase0.Slot) {
+	log := vm.Logger
+
+	epoch := vm.spec.Epoch(slot)
+
+	if vm.monitored[phase0.ValidatorIndex(block.Get("proposer_index").Uint())] {
+		body, err := getJSON(fmt.Sprintf("%s/eth/v1/beacon/rewards/blocks/%d", vm.API, slot))
+		if err != nil {
+			log.Error().Err(err).Uint64("slot", uint64(slot)).Msg("Error getting block rewards")
+		} else {
+			vm.rewards.block(epoch).Proposal += gjson.GetBytes(body, "data.total").Int()
+		}
+	}
+
+	sc := vm.syncCommittee
+	if sc == nil || len(sc.Positions) == 0 || vm.spec.SyncCommitteePeriod(epoch) != sc.Period {
+		return
+	}
+
+	body, err := postJSON(fmt.Sprintf("%s/eth/v1/beacon/rewards/sync_committee/%d", vm.API, slot), indexList(sc.Members()))
+	if err != nil {
+		log.Error().Err(err).Uint64("slot", uint64(slot)).Msg("Error getting sync committee rewards")
+		return
+	}
+
+	for _, r := range gjson.GetBytes(body, "data").Array() {
+		if vm.monitored[phase0.ValidatorIndex(r.Get("validator_index").Uint())] {
+			vm.rewards.block(epoch).SyncCommittee += r.Get("reward").Int()
+		}
+	}
+}
+
+// accountEpoch is called at the start of epoch, and accounts the balance changes of the
+// previous epoch. The change consists of the block rewards of the previous epoch, and the
+// attestation rewards of the epoch before that, which are paid out at the epoch transition.
+func (vm *ValidatorMonitor) accountEpoch(epoch phase0.Epoch) error {
+	log := vm.Logger
+	r := vm.rewards
+
+	balances, err := vm.validatorBalances(fmt.Sprint(vm.spec.EpochStart(epoch)))
+	if err != nil {
+		return err
+	}
+
+	prev := epoch - 1
+	accountable := r.Sampled && r.Epoch == prev
+
+	last := r.Balances
+	r.Epoch, r.Balances, r.Sampled = epoch, balances, true
+
+	if !accountable {
+		return nil
+	}
+
+	blocks := r.block(prev)
+	for e := range r.Blocks {
+		if e <= prev {
+			delete(r.Blocks, e)
+		}
+	}
+
+	attestation, err := vm.attestationRewards(prev - 1)
+	if err != nil {
+		log.Error().Err(err).Uint64("epoch", uint64(prev-1)).Msg("Error getting attestation rewards")
+	}
+
+	var (
+		delta   int64
+		total   uint64
+		dropped []phase0.ValidatorIndex
+	)
+
+	for index, balance := range balances {
+		total += balance
+
+		before, ok := last[index]
+		if !ok {
+			continue
+		}
+
+		d := int64(balance) - int64(before)
+		if d < 0 {
+			dropped = append(dropped, index)
+		}
+		delta += d
+	}
+
+	r.add(delta)
+	day, week := r.Totals()
+
+	metrics.ValidatorEpochRewards.WithLabelValues("total").Set(float64(delta))
+	metrics.ValidatorEpochRewards.WithLabelValues("attestation").Set(float64(attestation))
+	metrics.ValidatorEpochRewards.WithLabelValues("proposal").Set(float64(blocks.Proposal))
+	metrics.ValidatorEpochRewards.WithLabelValues("sync_committee").Set(float64(blocks.SyncCommittee))
+
+	ev := log.Info()
+	if delta < 0 {
+		ev = log.Warn()
+	}
+
+	ev.Uint64("epoch", uint64(prev)).
+		Int("validators", len(balances)).
+		Uint64("balance", total).
+		Int64("delta", delta).
+		Int64("attestation", attestation).
+		Int64("proposal", blocks.Proposal).
+		Int64("sync_committee", blocks.SyncCommittee).
+		Int64("other", delta-attestation-blocks.Proposal-blocks.SyncCommittee).
+		Int64("day", day).
+		Int64("week", week).
+		Msg("Epoch rewards")
+
+	if len(dropped) > 0 {
+		log.Warn().Uint64("epoch", uint64(prev)).Uints64("validators", uint64s(dropped)).Msg("Validator balances dropped")
+		sendAlert(vm.Notifier, log, notify.Alert{
+			Level:   notify.Warning,
+			Source:  SourceValidator,
+			Message: fmt.Sprintf("Balance of %d validators dropped in epoch %d (total delta %d Gwei)", len(dropped), prev, delta),
+		})
+	}
+
+	return nil
+}
+
+// attestationRewards returns the sum of the attestation rewards (and penalties) of our
+// validators for epoch.
+func (vm *ValidatorMonitor) attestationRewards(epoch phase0.Epoch) (int64, error) {
+	body, err := postJSON(fmt.Sprintf("%s/eth/v1/beacon/rewards/attestations/%d", vm.API, epoch), indexList(vm.Indices))
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, r := range gjson.GetBytes(body, "data.total_rewards").Array() {
+		if !vm.monitored[phase0.ValidatorIndex(r.Get("validator_index").Uint())] {
+			continue
+		}
+
+		r.ForEach(func(key, value gjson.Result) bool {
+			if key.String() != "validator_index" {
+				total += value.Int()
+			}
+			return true
+		})
+	}
+
+	return total, nil
+}
+
+// indexList returns the indices as a JSON array of strings, as used in the request bodies.
+func indexList(indices []phase0.ValidatorIndex) string {
+	ids := make([]string, len(indices))
+	for i, index := range indices {
+		ids[i] = fmt.Sprintf(`"%d"`, index)
+	}
+
+	return "[" + strings.Join(ids, ",") + "]"
+}
@@ -0,0 +1,212 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/tidwall/gjson"
+)
+
+// Fork names, in order of activation
+const (
+	ForkPhase0    = "phase0"
+	ForkAltair    = "altair"
+	ForkBellatrix = "bellatrix"
+	ForkCapella   = "capella"
+	ForkDeneb     = "deneb"
+	ForkElectra   = "electra"
+	ForkFulu      = "fulu"
+)
+
+var forkOrder = []string{ForkPhase0, ForkAltair, ForkBellatrix, ForkCapella, ForkDeneb, ForkElectra, ForkFulu}
+
+func forkIndex(name string) int {
+	for i, n := range forkOrder {
+		if n == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+type Fork struct {
+	Name    string
+	Version string
+	Epoch   phase0.Epoch
+}
+
+// Spec holds the chain configuration of the beacon node, so the monitors work on
+// every network and preset.
+type Spec struct {
+	ConfigName                   string
+	PresetBase                   string
+	Genesis                      time.Time
+	SlotDuration                 time.Duration
+	SlotsPerEpoch                uint64
+	EpochsPerSyncCommitteePeriod uint64
+	// Forks in the fork schedule, ordered by epoch
+	Forks []Fork
+}
+
+// NewSpec fetches the chain spec, genesis and fork schedule from the beacon API.
+func NewSpec(api string) (*Spec, error) {
+	body, err := getJSON(api + "/eth/v1/config/spec")
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return nil, errors.New("chain spec not found")
+	}
+
+	cfg := gjson.GetBytes(body, "data")
+	s := &Spec{
+		ConfigName:                   cfg.Get("CONFIG_NAME").String(),
+		PresetBase:                   cfg.Get("PRESET_BASE").String(),
+		SlotDuration:                 time.Duration(cfg.Get("SECONDS_PER_SLOT").Uint()) * time.Second,
+		SlotsPerEpoch:                cfg.Get("SLOTS_PER_EPOCH").Uint(),
+		EpochsPerSyncCommitteePeriod: cfg.Get("EPOCHS_PER_SYNC_COMMITTEE_PERIOD").Uint(),
+	}
+
+	if s.SlotDuration == 0 || s.SlotsPerEpoch == 0 {
+		return nil, errors.New("no SECONDS_PER_SLOT or SLOTS_PER_EPOCH in chain spec")
+	}
+
+	// Fork names by version, the schedule only contains the versions
+	names := make(map[string]string)
+	cfg.ForEach(func(key, value gjson.Result) bool {
+		if k := key.String(); strings.HasSuffix(k, "_FORK_VERSION") {
+			name := strings.ToLower(strings.TrimSuffix(k, "_FORK_VERSION"))
+			if name == "genesis" {
+				name = ForkPhase0
+			}
+			names[value.String()] = name
+		}
+		return true
+	})
+
+	body, err = getJSON(api + "/eth/v1/beacon/genesis")
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return nil, errors.New("chain hasn't started yet")
+	}
+
+	s.Genesis = time.Unix(gjson.GetBytes(body, "data.genesis_time").Int(), 0)
+
+	body, err = getJSON(api + "/eth/v1/config/fork_schedule")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range gjson.GetBytes(body, "data").Array() {
+		version := f.Get("current_version").String()
+		name, ok := names[version]
+		if !ok {
+			name = version
+		}
+
+		s.Forks = append(s.Forks, Fork{
+			Name:    name,
+			Version: version,
+			Epoch:   phase0.Epoch(f.Get("epoch").Uint()),
+		})
+	}
+
+	if len(s.Forks) == 0 {
+		return nil, errors.New("empty fork schedule")
+	}
+
+	sort.SliceStable(s.Forks, func(i, j int) bool {
+		return s.Forks[i].Epoch < s.Forks[j].Epoch
+	})
+
+	return s, nil
+}
+
+// Network returns the name of the network, with the preset if it's not the default.
+func (s *Spec) Network() string {
+	if s.PresetBase != "" && s.PresetBase != s.ConfigName {
+		return fmt.Sprintf("%s (%s preset)", s.ConfigName, s.PresetBase)
+	}
+
+	return s.ConfigName
+}
+
+// Epoch returns the epoch slot is in.
+func (s *Spec) Epoch(slot phase0.Slot) phase0.Epoch {
+	return phase0.Epoch(uint64(slot) / s.SlotsPerEpoch)
+}
+
+// EpochStart returns the first slot of epoch.
+func (s *Spec) EpochStart(epoch phase0.Epoch) phase0.Slot {
+	return phase0.Slot(uint64(epoch) * s.SlotsPerEpoch)
+}
+
+// InclusionDeadline returns the first slot in which an attestation of slot can't be included
+// anymore. Since Deneb (EIP-7045) attestations can be included until the end of the next
+// epoch, before that only within an epoch of their slot.
+func (s *Spec) InclusionDeadline(slot phase0.Slot) phase0.Slot {
+	epoch := s.Epoch(slot)
+	if s.Active(ForkDeneb, epoch) {
+		return s.EpochStart(epoch + 2)
+	}
+
+	return slot + phase0.Slot(s.SlotsPerEpoch)
+}
+
+// EpochDuration returns the duration of an epoch.
+func (s *Spec) EpochDuration() time.Duration {
+	return time.Duration(s.SlotsPerEpoch) * s.SlotDuration
+}
+
+// EpochsPerDay returns the number of epochs in a day.
+func (s *Spec) EpochsPerDay() int {
+	return int(24 * time.Hour / s.EpochDuration())
+}
+
+// SyncCommitteePeriod returns the sync committee period epoch is in.
+func (s *Spec) SyncCommitteePeriod(epoch phase0.Epoch) uint64 {
+	if s.EpochsPerSyncCommitteePeriod == 0 {
+		// Phase0 only network
+		return 0
+	}
+
+	return uint64(epoch) / s.EpochsPerSyncCommitteePeriod
+}
+
+// ForkAt returns the fork that's active at epoch.
+func (s *Spec) ForkAt(epoch phase0.Epoch) Fork {
+	fork := s.Forks[0]
+	for _, f := range s.Forks {
+		if f.Epoch <= epoch {
+			fork = f
+		}
+	}
+
+	return fork
+}
+
+// Active reports if the fork with name is active at epoch. Networks can start at a later
+// fork, so earlier forks don't have to be in the schedule.
+func (s *Spec) Active(name string, epoch phase0.Epoch) bool {
+	current, target := forkIndex(s.ForkAt(epoch).Name), forkIndex(name)
+	if current >= 0 && target >= 0 {
+		return current >= target
+	}
+
+	for _, f := range s.Forks {
+		if f.Name == name {
+			return f.Epoch <= epoch
+		}
+	}
+
+	return false
+}
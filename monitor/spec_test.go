@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"testing"
+)
+
+func TestForks(t *testing.T) {
+	// Devnet that starts at Deneb and forks to Electra
+	s := &Spec{
+		SlotsPerEpoch: 8,
+		Forks: []Fork{
+			{Name: ForkDeneb, Epoch: 0},
+			{Name: ForkElectra, Epoch: 10},
+		},
+	}
+
+	if f := s.ForkAt(9); f.Name != ForkDeneb {
+		t.Errorf("expected deneb at epoch 9, got %s", f.Name)
+	}
+
+	if f := s.ForkAt(10); f.Name != ForkElectra {
+		t.Errorf("expected electra at epoch 10, got %s", f.Name)
+	}
+
+	if !s.Active(ForkAltair, 0) {
+		t.Error("expected altair to be active at genesis")
+	}
+
+	if s.Active(ForkElectra, 9) || !s.Active(ForkElectra, 10) {
+		t.Error("expected electra to be active from epoch 10")
+	}
+
+	if e := s.Epoch(80); e != 10 {
+		t.Errorf("expected slot 80 in epoch 10, got %d", e)
+	}
+}
+
+func TestInclusionDeadline(t *testing.T) {
+	s := &Spec{
+		SlotsPerEpoch: 8,
+		Forks: []Fork{
+			{Name: ForkCapella, Epoch: 0},
+			{Name: ForkDeneb, Epoch: 10},
+		},
+	}
+
+	// One epoch after the slot before Deneb
+	if d := s.InclusionDeadline(75); d != 83 {
+		t.Errorf("expected slot 83 before deneb, got %d", d)
+	}
+
+	// Until the end of the next epoch since Deneb
+	if d := s.InclusionDeadline(80); d != 96 {
+		t.Errorf("expected slot 96 at the start of the epoch, got %d", d)
+	}
+
+	if d := s.InclusionDeadline(87); d != 96 {
+		t.Errorf("expected slot 96 at the end of the epoch, got %d", d)
+	}
+}
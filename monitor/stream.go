@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	web "net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netbound/e7mon/notify"
+
+	api "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/rs/zerolog"
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// retryDelay returns the exponential backoff delay for the attempt, starting at 0.
+func retryDelay(attempt int) time.Duration {
+	if attempt > 6 {
+		return maxRetryDelay
+	}
+
+	if d := minRetryDelay << attempt; d < maxRetryDelay {
+		return d
+	}
+
+	return maxRetryDelay
+}
+
+// supervisor keeps a connection (subscription or event stream) up, and reconnects with
+// an exponential backoff when it drops.
+type supervisor struct {
+	Name     string
+	Source   string
+	Logger   zerolog.Logger
+	Notifier notify.Notifier
+	// Called when the connection is lost and when it's restored, e.g. to pause the block timers
+	OnDown func()
+	OnUp   func()
+}
+
+// Run calls connect forever. Connect should block for as long as the connection is up,
+// and call up once it's established.
+func (s supervisor) Run(connect func(up func()) error) {
+	log := s.Logger
+
+	var (
+		down    time.Time
+		attempt int
+	)
+
+	up := func() {
+		attempt = 0
+		if down.IsZero() {
+			return
+		}
+
+		outage := time.Since(down).Round(time.Second)
+		log.Info().Str("outage", outage.String()).Msgf("%s connection restored", s.Name)
+		sendAlert(s.Notifier, log, notify.Alert{
+			Level:   notify.Info,
+			Source:  s.Source,
+			Message: fmt.Sprintf("%s connection restored after %s", s.Name, outage),
+		})
+
+		down = time.Time{}
+		if s.OnUp != nil {
+			s.OnUp()
+		}
+	}
+
+	for {
+		err := connect(up)
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+
+		if down.IsZero() {
+			down = time.Now()
+			log.Warn().Err(err).Msgf("%s connection lost", s.Name)
+			sendAlert(s.Notifier, log, notify.Alert{
+				Level:   notify.Warning,
+				Source:  s.Source,
+				Message: fmt.Sprintf("%s connection lost: %s", s.Name, err),
+			})
+
+			if s.OnDown != nil {
+				s.OnDown()
+			}
+		}
+
+		delay := retryDelay(attempt)
+		attempt++
+
+		log.Debug().Err(err).Str("retry_in", delay.String()).Msgf("Reconnecting to %s", s.Name)
+		time.Sleep(delay)
+	}
+}
+
+// streamEvents subscribes to the server sent events of the beacon API. It blocks until
+// the stream is closed.
+// https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events
+func streamEvents(log zerolog.Logger, apiURL string, topics []string, handler func(*api.Event), up func()) error {
+	query := url.Values{"topics": topics}
+	req, err := web.NewRequest("GET", apiURL+"/eth/v1/events?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := web.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != web.StatusOK {
+		return fmt.Errorf("GET %s: %s", req.URL, res.Status)
+	}
+
+	up()
+
+	var (
+		topic string
+		data  bytes.Buffer
+	)
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// Blank line dispatches the event
+			if topic != "" && data.Len() > 0 {
+				event, err := parseEvent(topic, data.Bytes())
+				if err != nil {
+					log.Error().Err(err).Msg("Error parsing event")
+				} else {
+					handler(event)
+				}
+			}
+			topic = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			topic = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("event stream closed")
+}
+
+// parseEvent decodes the data of an event. Topics we don't use are passed on without data.
+func parseEvent(topic string, data []byte) (*api.Event, error) {
+	event := &api.Event{Topic: topic}
+
+	switch topic {
+	case "head":
+		event.Data = &api.HeadEvent{}
+	case "block":
+		event.Data = &api.BlockEvent{}
+	case "finalized_checkpoint":
+		event.Data = &api.FinalizedCheckpointEvent{}
+	case "chain_reorg":
+		event.Data = &api.ChainReorgEvent{}
+	default:
+		return event, nil
+	}
+
+	if err := json.Unmarshal(data, event.Data); err != nil {
+		return nil, fmt.Errorf("parsing %s event: %w", topic, err)
+	}
+
+	return event, nil
+}
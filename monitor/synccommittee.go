@@ -0,0 +1,181 @@
+package monitor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/tidwall/gjson"
+)
+
+type syncCommittee struct {
+	Period uint64
+	// Positions of our validators in the committee, a validator can be selected more than once
+	Positions   map[phase0.ValidatorIndex][]int
+	Included    int
+	Missed      int
+	Consecutive map[phase0.ValidatorIndex]int
+}
+
+func (sc *syncCommittee) Participation() float64 {
+	if sc.Included+sc.Missed == 0 {
+		return 0
+	}
+
+	return float64(sc.Included) / float64(sc.Included+sc.Missed) * 100
+}
+
+func (sc *syncCommittee) Members() []phase0.ValidatorIndex {
+	members := make([]phase0.ValidatorIndex, 0, len(sc.Positions))
+	for index := range sc.Positions {
+		members = append(members, index)
+	}
+
+	return members
+}
+
+// updateSyncCommittee reports the participation in the current sync committee period, and looks
+// up the positions of our validators in the committees when a new period starts.
+func (vm *ValidatorMonitor) updateSyncCommittee(epoch phase0.Epoch) error {
+	log := vm.Logger
+
+	period := vm.spec.SyncCommitteePeriod(epoch)
+	sc := vm.syncCommittee
+
+	if sc != nil && len(sc.Positions) > 0 {
+		msg := "Sync committee participation"
+		if sc.Period != period {
+			msg = "Sync committee period ended"
+		}
+
+		log.Info().Uint64("period", sc.Period).
+			Int("validators", len(sc.Positions)).
+			Int("included", sc.Included).
+			Int("missed", sc.Missed).
+			Str("participation", fmt.Sprintf("%.2f%%", sc.Participation())).
+			Msg(msg)
+	}
+
+	if sc != nil && sc.Period == period {
+		return nil
+	}
+
+	positions, err := vm.syncCommitteePositions(epoch)
+	if err != nil {
+		return err
+	}
+
+	sc = &syncCommittee{
+		Period:      period,
+		Positions:   positions,
+		Consecutive: make(map[phase0.ValidatorIndex]int),
+	}
+	vm.syncCommittee = sc
+
+	if len(positions) > 0 {
+		log.Info().Uint64("period", period).Uints64("validators", uint64s(sc.Members())).Msg("Validators in the current sync committee")
+	}
+
+	nextPeriod := phase0.Epoch((period + 1) * vm.spec.EpochsPerSyncCommitteePeriod)
+	next, err := vm.syncCommitteePositions(nextPeriod)
+	if err != nil {
+		// Only available once the next committee is known
+		log.Debug().Err(err).Msg("Error getting next sync committee")
+		return nil
+	}
+
+	if len(next) > 0 {
+		members := (&syncCommittee{Positions: next}).Members()
+		log.Info().Uint64("period", period+1).Uint64("in_epochs", uint64(nextPeriod-epoch)).Uints64("validators", uint64s(members)).Msg("Validators in the next sync committee")
+	}
+
+	return nil
+}
+
+// checkSyncAggregate checks if our validators signed the sync aggregate included in the block.
+func (vm *ValidatorMonitor) checkSyncAggregate(block gjson.Result, slot phase0.Slot) {
+	log := vm.Logger
+
+	sc := vm.syncCommittee
+	if sc == nil || len(sc.Positions) == 0 || vm.spec.SyncCommitteePeriod(vm.spec.Epoch(slot)) != sc.Period {
+		return
+	}
+
+	// There are no sync aggregates before Altair
+	if !vm.spec.Active(ForkAltair, vm.spec.Epoch(slot)) {
+		return
+	}
+
+	bits, err := hex.DecodeString(strings.TrimPrefix(block.Get("body.sync_aggregate.sync_committee_bits").String(), "0x"))
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding sync committee bits")
+		return
+	}
+
+	threshold := vm.Config.SyncCommitteeMisses
+	if threshold == 0 {
+		threshold = 3
+	}
+
+	var missed []phase0.ValidatorIndex
+	for index, positions := range sc.Positions {
+		signed := true
+		for _, pos := range positions {
+			if bitAt(bits, uint64(pos)) {
+				sc.Included++
+				metrics.ValidatorSyncSignatures.WithLabelValues(fmt.Sprint(index), "included").Inc()
+				continue
+			}
+
+			signed = false
+			sc.Missed++
+			metrics.ValidatorSyncSignatures.WithLabelValues(fmt.Sprint(index), "missed").Inc()
+		}
+
+		if signed {
+			sc.Consecutive[index] = 0
+			continue
+		}
+
+		missed = append(missed, index)
+		sc.Consecutive[index]++
+
+		if sc.Consecutive[index] == threshold {
+			sendAlert(vm.Notifier, log, notify.Alert{
+				Level:   notify.Critical,
+				Source:  SourceValidator,
+				Message: fmt.Sprintf("Validator %d missed %d consecutive sync committee signatures (slot %d)", index, threshold, slot),
+			})
+		}
+	}
+
+	if len(missed) > 0 {
+		log.Warn().Uint64("slot", uint64(slot)).Uints64("validators", uint64s(missed)).Msg("Missed sync committee signatures")
+	}
+}
+
+// syncCommitteePositions returns the positions of our validators in the sync committee of the
+// period epoch is in.
+func (vm *ValidatorMonitor) syncCommitteePositions(epoch phase0.Epoch) (map[phase0.ValidatorIndex][]int, error) {
+	body, err := getJSON(fmt.Sprintf("%s/eth/v1/beacon/states/head/sync_committees?epoch=%d", vm.API, epoch))
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return nil, fmt.Errorf("no sync committee found for epoch %d", epoch)
+	}
+
+	positions := make(map[phase0.ValidatorIndex][]int)
+	for i, v := range gjson.GetBytes(body, "data.validators").Array() {
+		if index := phase0.ValidatorIndex(v.Uint()); vm.monitored[index] {
+			positions[index] = append(positions[index], i)
+		}
+	}
+
+	return positions, nil
+}
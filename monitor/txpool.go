@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// JSON-RPC error code for methods that don't exist or aren't exposed
+const errCodeMethodNotFound = -32601
+
+// txpoolState is kept between runs of the txpool stat.
+type txpoolState struct {
+	// Pending transactions received since the last run, first for 64-bit alignment
+	received int64
+
+	Pending uint64
+	Queued  uint64
+	Sampled bool
+	Empty   bool
+
+	// Count the pending transactions when txpool_status isn't available
+	Fallback bool
+	since    time.Time
+	// Neither is available
+	Disabled bool
+}
+
+// TxPoolStatus returns the number of pending and queued transactions in the pool.
+func (em ExecutionMonitor) TxPoolStatus() (pending, queued uint64, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var status struct {
+		Pending hexutil.Uint64 `json:"pending"`
+		Queued  hexutil.Uint64 `json:"queued"`
+	}
+
+	err = em.Client.CallContext(ctx, &status, "txpool_status")
+
+	return uint64(status.Pending), uint64(status.Queued), err
+}
+
+// countPendingTransactions counts the transactions from the newPendingTransactions subscription.
+func (em ExecutionMonitor) countPendingTransactions(state *txpoolState) {
+	log := em.Logger
+
+	for attempt := 0; ; attempt++ {
+		c := make(chan common.Hash, 1024)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		sub, err := em.Client.EthSubscribe(ctx, c, "newPendingTransactions")
+		cancel()
+
+		if err == nil {
+			attempt = 0
+			func() {
+				defer sub.Unsubscribe()
+				for {
+					select {
+					case err = <-sub.Err():
+						return
+					case <-c:
+						atomic.AddInt64(&state.received, 1)
+					}
+				}
+			}()
+		}
+
+		log.Debug().Err(err).Msg("[TXPOOL] Pending transactions subscription failed")
+		time.Sleep(retryDelay(attempt))
+	}
+}
+
+// txpoolStat reports the size of the transaction pool and its trend, and warns when it's
+// empty, which usually means transactions aren't gossiped to us.
+func (em ExecutionMonitor) txpoolStat(state *txpoolState) error {
+	log := em.Logger
+
+	if state.Disabled {
+		return nil
+	}
+
+	var (
+		empty bool
+		err   error
+	)
+
+	if !state.Fallback {
+		empty, err = em.txpoolStatus(state)
+
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == errCodeMethodNotFound {
+			if u, err := url.Parse(em.Config.API); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				log.Warn().Msg("[TXPOOL] txpool_status isn't available, and pending transactions can't be counted over HTTP")
+				state.Disabled = true
+				return nil
+			}
+
+			log.Warn().Msg("[TXPOOL] txpool_status isn't available, counting pending transactions instead")
+
+			state.Fallback = true
+			state.since = time.Now()
+			go em.countPendingTransactions(state)
+			return nil
+		}
+	} else {
+		empty = em.pendingRate(state)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !empty {
+		if state.Empty {
+			log.Info().Msg("[TXPOOL] Receiving transactions again")
+		}
+		state.Empty = false
+		return nil
+	}
+
+	// An empty pool is expected while syncing
+	if progress, err := em.SyncStatus(); err != nil || progress != nil {
+		return err
+	}
+
+	log.Warn().Msg("[TXPOOL] Transaction pool is empty, is transaction gossip working?")
+	if !state.Empty {
+		sendAlert(em.Notifier, log, notify.Alert{
+			Level:   notify.Warning,
+			Source:  SourceExecution,
+			Message: "Transaction pool is empty, transaction gossip might be broken",
+		})
+	}
+	state.Empty = true
+
+	return nil
+}
+
+// txpoolStatus reports the pending and queued transactions, and if the pool is empty.
+func (em ExecutionMonitor) txpoolStatus(state *txpoolState) (bool, error) {
+	pending, queued, err := em.TxPoolStatus()
+	if err != nil {
+		return false, err
+	}
+
+	metrics.ExecutionTxPool.WithLabelValues("pending").Set(float64(pending))
+	metrics.ExecutionTxPool.WithLabelValues("queued").Set(float64(queued))
+
+	ev := em.Logger.Info().Uint64("pending", pending).Uint64("queued", queued)
+	if state.Sampled {
+		ev = ev.Str("pending_trend", fmt.Sprintf("%+d", int64(pending)-int64(state.Pending))).
+			Str("queued_trend", fmt.Sprintf("%+d", int64(queued)-int64(state.Queued)))
+	}
+	ev.Msg("[TXPOOL] Transaction pool")
+
+	state.Pending, state.Queued, state.Sampled = pending, queued, true
+
+	return pending == 0, nil
+}
+
+// pendingRate reports the rate of new pending transactions since the last run, and if
+// there were none.
+func (em ExecutionMonitor) pendingRate(state *txpoolState) bool {
+	received := atomic.SwapInt64(&state.received, 0)
+	now := time.Now()
+
+	rate := float64(received) / now.Sub(state.since).Seconds()
+	state.since = now
+
+	metrics.ExecutionPendingTxRate.Set(rate)
+	em.Logger.Info().Int64("received", received).Str("rate", fmt.Sprintf("%.2f tx/s", rate)).Msg("[TXPOOL] Pending transactions")
+
+	return received == 0
+}
@@ -2,24 +2,56 @@ package monitor
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	api "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/attestantio/go-eth2-client/http"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/fatih/color"
 	"github.com/netbound/e7mon/config"
+	"github.com/netbound/e7mon/metrics"
+	"github.com/netbound/e7mon/notify"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/tidwall/gjson"
 )
 
 type ValidatorMonitor struct {
-	API    string
-	Config *config.ValidatorConfig
-	Client *http.Service
-	Logger zerolog.Logger
+	API      string
+	Config   *config.ValidatorConfig
+	Metrics  *config.MetricsConfig
+	Client   *http.Service
+	Logger   zerolog.Logger
+	Notifier *notify.Dispatcher
+	// Indices of the monitored validators, resolved on start
+	Indices []phase0.ValidatorIndex
+
+	monitored map[phase0.ValidatorIndex]bool
+	spec      *Spec
+	following bool
+	// Called with the execution block hash of our proposals
+	proposalHandlers []func(common.Hash)
+
+	// Only accessed by followChain
+	attesterDuties []*api.AttesterDuty
+	attestations   map[phase0.Epoch]*attestationSummary
+	roots          map[phase0.Slot]phase0.Root
+	justified      map[phase0.Epoch]*phase0.Checkpoint
+	committees     map[phase0.Slot]map[phase0.CommitteeIndex]uint64
+	syncCommittee  *syncCommittee
+	rewards        *rewards
+
+	mu        sync.Mutex
+	proposals map[phase0.Slot]*proposal
+	// Set once the validators and spec are resolved, for the handlers called by the beacon monitor
+	ready bool
 }
 
 func NewValidatorMonitor() *ValidatorMonitor {
@@ -52,57 +84,245 @@ func NewValidatorMonitor() *ValidatorMonitor {
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Can't connect to JSON-RPC API, is the endpoint correct and running?")
 	}
+
+	notifier, err := notify.New(cfg.AlertsConfig)
+	if err != nil {
+		logger.Fatal().Msg(err.Error())
+	}
+
 	return &ValidatorMonitor{
-		API:    cfg.BeaconConfig.API,
-		Config: cfg.ValidatorConfig,
-		Client: c,
-		Logger: logger,
+		API:      cfg.BeaconConfig.API,
+		Config:   cfg.ValidatorConfig,
+		Metrics:  cfg.MetricsConfig,
+		Client:   c,
+		Logger:   logger,
+		Notifier: notifier,
+
+		monitored:    make(map[phase0.ValidatorIndex]bool),
+		attestations: make(map[phase0.Epoch]*attestationSummary),
+		roots:        make(map[phase0.Slot]phase0.Root),
+		justified:    make(map[phase0.Epoch]*phase0.Checkpoint),
+		committees:   make(map[phase0.Slot]map[phase0.CommitteeIndex]uint64),
+		proposals:    make(map[phase0.Slot]*proposal),
 	}
 }
 
 func (vm *ValidatorMonitor) Start() {
 	log := vm.Logger
 
-	// ctx, cancel := context.WithCancel(context.Background())
-	// defer cancel()
+	if err := vm.resolveValidators(); err != nil {
+		log.Fatal().Err(err).Msg("Error resolving validators")
+	}
+
+	balances, err := vm.validatorBalances("head")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error getting balances")
+	}
+
+	var total uint64
+	for _, b := range balances {
+		total += b
+	}
+
+	ev := log.Info()
+	if len(vm.Indices) == 1 {
+		ev = ev.Uint64("validator_index", uint64(vm.Indices[0]))
+	} else {
+		ev = ev.Int("validators", len(vm.Indices))
+	}
+	ev.Uint64("balance", total).Msg("Starting validator monitor")
+
+	metrics.Serve(vm.Metrics)
+
+	vm.spec, err = NewSpec(vm.API)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error getting chain spec")
+	}
+	vm.rewards = newRewards(vm.spec.EpochsPerDay())
+
+	vm.mu.Lock()
+	vm.ready = true
+	vm.mu.Unlock()
+
+	if !vm.following {
+		go vm.subscribeToBlocks()
+	}
+
+	go vm.trackProposals()
 
-	balance, err := vm.validatorBalance(vm.Config.Index)
+	vm.followChain()
+}
+
+// resolveValidators resolves the configured indices and public keys to validator indices.
+// Public keys are looked up in a single request.
+func (vm *ValidatorMonitor) resolveValidators() error {
+	log := vm.Logger
+
+	ids, err := vm.Config.Identifiers()
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error getting balance")
+		return err
+	}
+
+	var pubkeys []phase0.BLSPubKey
+	for _, id := range ids {
+		if strings.HasPrefix(id, "0x") {
+			b, err := hex.DecodeString(id[2:])
+			if err != nil || len(b) != len(phase0.BLSPubKey{}) {
+				return fmt.Errorf("invalid validator public key '%s'", id)
+			}
+
+			var pubkey phase0.BLSPubKey
+			copy(pubkey[:], b)
+			pubkeys = append(pubkeys, pubkey)
+			continue
+		}
+
+		index, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid validator index '%s'", id)
+		}
+
+		vm.addValidator(phase0.ValidatorIndex(index))
+	}
+
+	if len(pubkeys) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		validators, err := vm.Client.ValidatorsByPubKey(ctx, "head", pubkeys)
+		if err != nil {
+			return err
+		}
+
+		for index := range validators {
+			vm.addValidator(index)
+		}
+
+		if len(validators) < len(pubkeys) {
+			log.Warn().Int("not_found", len(pubkeys)-len(validators)).Msg("Public keys without a validator index")
+		}
 	}
 
-	log.Info().Uint64("validator_index", vm.Config.Index).Uint64("balance", balance).Msg("Starting validator monitor")
+	if len(vm.Indices) == 0 {
+		return fmt.Errorf("no validators configured")
+	}
 
-	// TODO: only subscribe to attestations OUR validator produces
-	// vm.subscribeToAttestations(ctx)
+	return nil
+}
 
-	select {}
+func (vm *ValidatorMonitor) addValidator(index phase0.ValidatorIndex) {
+	if !vm.monitored[index] {
+		vm.monitored[index] = true
+		vm.Indices = append(vm.Indices, index)
+	}
 }
 
-func (vm *ValidatorMonitor) subscribeToAttestations(ctx context.Context) {
-	err := vm.Client.Events(ctx, []string{"attestation"}, func(event *api.Event) {
-		attestation := event.Data.(*phase0.Attestation)
+// followChain follows the head of the chain and scans every new block for the attestations
+// and sync committee signatures of our validators.
+func (vm *ValidatorMonitor) followChain() {
+	log := vm.Logger
+
+	var (
+		scanned   phase0.Slot
+		epoch     phase0.Epoch
+		accounted phase0.Epoch
+	)
+
+	for range time.Tick(vm.spec.SlotDuration) {
+		head, err := vm.headSlot()
+		if err != nil {
+			log.Error().Err(err).Msg("Error getting head slot")
+			continue
+		}
+
+		first := scanned == 0
+		if first {
+			// Start scanning at head, older blocks aren't checked
+			scanned = head
+		}
+
+		if current := vm.spec.Epoch(head); first || current > epoch {
+			if err := vm.updateAttesterDuties(current, scanned); err != nil {
+				log.Error().Err(err).Msg("Error getting attester duties")
+				continue
+			}
+
+			if err := vm.updateSyncCommittee(current); err != nil {
+				log.Error().Err(err).Msg("Error getting sync committee")
+			}
 
-		vm.Logger.Info().Uint64("committee", uint64(attestation.Data.Index)).Msg("New attestation")
-	})
+			epoch = current
+		}
+
+		for slot := scanned + 1; slot <= head; slot++ {
+			block, found, err := vm.block(slot)
+			if err != nil {
+				log.Error().Err(err).Uint64("slot", uint64(slot)).Msg("Error getting block")
+				break
+			}
+
+			if found {
+				if err := vm.checkInclusions(block, slot); err != nil {
+					log.Error().Err(err).Uint64("slot", uint64(slot)).Msg("Error checking attestations")
+				}
+
+				vm.checkSyncAggregate(block, slot)
+				vm.collectBlockRewards(block, slot)
+			}
+
+			scanned = slot
+		}
+
+		vm.expireAttestations(scanned)
+
+		// All the blocks of the previous epoch are scanned
+		if e := vm.spec.Epoch(scanned); e > accounted {
+			if err := vm.accountEpoch(e); err != nil {
+				log.Error().Err(err).Msg("Error accounting epoch rewards")
+			}
+			accounted = e
+		}
+	}
+}
+
+func (vm *ValidatorMonitor) headSlot() (phase0.Slot, error) {
+	body, err := getJSON(vm.API + "/eth/v1/beacon/headers/head")
 	if err != nil {
-		log.Fatal().Err(err).Msg("")
+		return 0, err
 	}
+
+	return phase0.Slot(gjson.GetBytes(body, "data.header.message.slot").Uint()), nil
 }
 
-func (vm *ValidatorMonitor) validatorBalance(index uint64) (uint64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+// validatorBalances returns the balances of all our validators at the state in a single request.
+func (vm *ValidatorMonitor) validatorBalances(stateID string) (map[phase0.ValidatorIndex]uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	res, err := vm.Client.ValidatorBalances(ctx, "head", []phase0.ValidatorIndex{phase0.ValidatorIndex(index)})
+	res, err := vm.Client.ValidatorBalances(ctx, stateID, vm.Indices)
 	if err != nil {
-		log.Fatal().Err(err).Msg("")
+		return nil, err
+	}
+
+	if len(res) < len(vm.Indices) {
+		vm.Logger.Warn().Int("not_found", len(vm.Indices)-len(res)).Msg("Validators not found")
 	}
 
-	if len(res) == 0 {
-		log.Warn().Msg("Validator not found")
-		return 0, nil
+	balances := make(map[phase0.ValidatorIndex]uint64, len(res))
+	for index, balance := range res {
+		balances[index] = uint64(balance)
+		metrics.ValidatorBalance.WithLabelValues(fmt.Sprint(index)).Set(float64(balance))
+	}
+
+	return balances, nil
+}
+
+// uint64s converts indices for logging.
+func uint64s(indices []phase0.ValidatorIndex) []uint64 {
+	res := make([]uint64, len(indices))
+	for i, index := range indices {
+		res[i] = uint64(index)
 	}
 
-	return uint64(res[phase0.ValidatorIndex(index)]), nil
+	return res
 }
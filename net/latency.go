@@ -24,12 +24,24 @@ func (r *Results) Reset() {
 var results Results = make(map[string]time.Duration)
 var mu sync.Mutex
 
+// Scanner sends TCP SYNs to hosts and measures the time until their SYN-ACK. On dual-stack
+// interfaces it scans both IPv4 and IPv6 hosts, otherwise only the family of the interface.
 type Scanner struct {
-	InterfaceName    string
+	InterfaceName string
+	Device        *net.Interface
+	Handle        *pcap.Handle
+	// Nil without IPv4
 	InterfaceAddress *pcap.InterfaceAddress
-	Device           *net.Interface
-	Handle           *pcap.Handle
 	GatewayMAC       net.HardwareAddr
+	// Nil without IPv6
+	InterfaceAddress6 *pcap.InterfaceAddress
+	GatewayMAC6       net.HardwareAddr
+}
+
+// networkLayer is an IPv4 or IPv6 layer.
+type networkLayer interface {
+	gopacket.NetworkLayer
+	gopacket.SerializableLayer
 }
 
 type LatencyResult struct {
@@ -66,26 +78,47 @@ func NewScanner(ifaceName string) *Scanner {
 		log.Fatal(err)
 	}
 
-	iAddr := getInterfaceAddress(i)
-	// No IPv4 address
-	if iAddr == nil {
-		log.Fatal(fmt.Errorf("can't get interface, please specify one in the config or provide with flag -i (--interface)"))
+	s := &Scanner{
+		InterfaceName: dev.Name,
+		Device:        dev,
 	}
 
-	dstMAC, err := getGatewayMAC(iAddr, dev)
-	if err != nil {
-		log.Fatal(err)
+	if iAddr := getInterfaceAddress(i); iAddr != nil {
+		if s.GatewayMAC, err = getGatewayMAC(iAddr, dev); err != nil {
+			log.Printf("can't resolve the IPv4 gateway, skipping IPv4 hosts: %s", err)
+		} else {
+			s.InterfaceAddress = iAddr
+		}
 	}
 
-	return &Scanner{
-		InterfaceName:    dev.Name,
-		InterfaceAddress: iAddr,
-		Device:           dev,
-		GatewayMAC:       dstMAC,
+	if iAddr6, linkLocal := getInterfaceAddress6(i); iAddr6 != nil {
+		if s.GatewayMAC6, err = getGatewayMAC6(linkLocal, dev); err != nil {
+			log.Printf("can't resolve the IPv6 gateway, skipping IPv6 hosts: %s", err)
+		} else {
+			s.InterfaceAddress6 = iAddr6
+		}
+	}
+
+	// No usable IPv4 or IPv6 address
+	if s.InterfaceAddress == nil && s.InterfaceAddress6 == nil {
+		log.Fatal(fmt.Errorf("can't get interface, please specify one in the config or provide with flag -i (--interface)"))
+	}
+
+	return s
+}
+
+// Supports returns whether the scanner can reach hosts with the IP's address family.
+func (s *Scanner) Supports(ip net.IP) bool {
+	if ip.To4() != nil {
+		return s.InterfaceAddress != nil
 	}
+
+	return ip.To16() != nil && s.InterfaceAddress6 != nil
 }
 
-// StartLatencyScan starts scanning the addresses provided in the format of "ip:port".
+// StartLatencyScan starts scanning the addresses provided in the format of "ip:port", or
+// "[ip]:port" for IPv6. The results are keyed by the hosts as provided. Invalid hosts and
+// hosts of an address family the interface doesn't have are skipped.
 func (s *Scanner) StartLatencyScan(hosts []string) (map[string]time.Duration, error) {
 	// Clear results, we don't want to keep old peers
 	results.Reset()
@@ -98,8 +131,9 @@ func (s *Scanner) StartLatencyScan(hosts []string) (map[string]time.Duration, er
 	// This takes long...
 	// defer s.Handle.Close()
 
-	// TCP SYN-ACK BPF filter
-	var filter = "tcp[tcpflags] & (tcp-syn|tcp-ack) != 0"
+	// TCP SYN-ACK BPF filter, tcpflags only works for IPv4 so IPv6 assumes the TCP header
+	// follows the fixed header
+	var filter = "(tcp[tcpflags] & (tcp-syn|tcp-ack) != 0) or (ip6 and ip6[6] == 6 and ip6[53] & 0x12 != 0)"
 	err = s.Handle.SetBPFFilter(filter)
 	if err != nil {
 		return nil, err
@@ -119,16 +153,37 @@ func (s *Scanner) StartLatencyScan(hosts []string) (map[string]time.Duration, er
 	// Start listening already
 	go s.startListener(ctx, packetSource, flows, reset)
 
+	// Requested hosts by the address replies are recorded under, which differs for
+	// IPv4-mapped and non-canonical IPv6 addresses
+	requested := make(map[string]string)
+
 	for _, host := range hosts {
 		dst, port, err := net.SplitHostPort(host)
 		if err != nil {
-			return nil, err
+			log.Printf("skipping host %s: %s", host, err)
+			continue
 		}
 
-		p, _ := strconv.Atoi(port)
+		ip := net.ParseIP(dst)
+		p, err := strconv.Atoi(port)
+		if ip == nil || err != nil || p <= 0 || p > 65535 {
+			log.Printf("skipping host %s: invalid address", host)
+			continue
+		}
+
+		// Mapped addresses are scanned over IPv4
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		if !s.Supports(ip) {
+			continue
+		}
+
+		requested[net.JoinHostPort(ip.String(), port)] = host
 
 		// Send TCP SYN packet for every address
-		pkt, dstport, err := s.buildSYNPacket(net.ParseIP(dst), uint16(p))
+		pkt, dstport, err := s.buildSYNPacket(ip, uint16(p))
 		if err != nil {
 			return nil, err
 		}
@@ -144,6 +199,10 @@ func (s *Scanner) StartLatencyScan(hosts []string) (map[string]time.Duration, er
 		}
 	}
 
+	if len(requested) == 0 {
+		return map[string]time.Duration{}, nil
+	}
+
 	ctr := 0
 	for rst := range reset {
 		// Not expired by timeout
@@ -160,12 +219,22 @@ func (s *Scanner) StartLatencyScan(hosts []string) (map[string]time.Duration, er
 		}
 
 		ctr++
-		if ctr >= len(hosts) {
+		if ctr >= len(requested) {
 			break
 		}
 	}
 
-	return results, nil
+	mu.Lock()
+	defer mu.Unlock()
+
+	res := make(map[string]time.Duration, len(results))
+	for addr, rtt := range results {
+		if host, ok := requested[addr]; ok {
+			res[host] = rtt
+		}
+	}
+
+	return res, nil
 }
 
 func (s *Scanner) startListener(ctx context.Context, src *gopacket.PacketSource, flows <-chan ListenParams, rst chan<- RSTSettings) {
@@ -173,7 +242,8 @@ func (s *Scanner) startListener(ctx context.Context, src *gopacket.PacketSource,
 	targetFlows := make(map[layers.TCPPort]time.Time)
 	var (
 		ethLayer layers.Ethernet
-		ip       layers.IPv4
+		ip4      layers.IPv4
+		ip6      layers.IPv6
 		tcp      layers.TCP
 
 		decoded = []gopacket.LayerType{}
@@ -182,21 +252,41 @@ func (s *Scanner) startListener(ctx context.Context, src *gopacket.PacketSource,
 	parser := gopacket.NewDecodingLayerParser(
 		layers.LayerTypeEthernet,
 		&ethLayer,
-		&ip,
+		&ip4,
+		&ip6,
 		&tcp,
 	)
+	parser.IgnoreUnsupported = true
 
 	go func() {
 		for packet := range src.Packets() {
 			parser.DecodeLayers(packet.Data(), &decoded)
+
+			var srcIP net.IP
+			isTCP := false
+			for _, t := range decoded {
+				switch t {
+				case layers.LayerTypeIPv4:
+					srcIP = ip4.SrcIP
+				case layers.LayerTypeIPv6:
+					srcIP = ip6.SrcIP
+				case layers.LayerTypeTCP:
+					isTCP = true
+				}
+			}
+
+			if srcIP == nil || !isTCP {
+				continue
+			}
+
 			if start, ok := targetFlows[tcp.DstPort]; ok {
 				// Possible concurrent writes to map here
 				mu.Lock()
-				results[fmt.Sprintf("%s:%d", ip.SrcIP, tcp.SrcPort)] = packet.Metadata().Timestamp.Sub(start)
+				results[net.JoinHostPort(srcIP.String(), strconv.Itoa(int(tcp.SrcPort)))] = packet.Metadata().Timestamp.Sub(start)
 				mu.Unlock()
 				rst <- RSTSettings{
 					Timeout: false,
-					DstIP:   ip.SrcIP,
+					DstIP:   srcIP,
 					SrcPort: tcp.DstPort,
 					DstPort: tcp.SrcPort,
 					Seq:     tcp.Ack + 1,
@@ -228,22 +318,46 @@ func (s *Scanner) sendSYNPacket(pkt []byte) (time.Time, error) {
 	return start, nil
 }
 
-func (s *Scanner) buildSYNPacket(dst net.IP, dstPort uint16) ([]byte, layers.TCPPort, error) {
-	buffer := gopacket.NewSerializeBuffer()
+// networkLayers returns the ethernet and IP layers of a TCP packet to dst, for its address family.
+func (s *Scanner) networkLayers(dst net.IP) (*layers.Ethernet, networkLayer, error) {
+	if !s.Supports(dst) {
+		return nil, nil, fmt.Errorf("can't reach %s from %s", dst, s.InterfaceName)
+	}
 
-	ether := &layers.Ethernet{
-		SrcMAC:       s.Device.HardwareAddr,
-		DstMAC:       s.GatewayMAC,
-		EthernetType: layers.EthernetTypeIPv4,
+	if dst.To4() != nil {
+		return &layers.Ethernet{
+			SrcMAC:       s.Device.HardwareAddr,
+			DstMAC:       s.GatewayMAC,
+			EthernetType: layers.EthernetTypeIPv4,
+		}, &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			SrcIP:    s.InterfaceAddress.IP,
+			DstIP:    dst,
+			Protocol: layers.IPProtocolTCP,
+			Flags:    layers.IPv4DontFragment,
+		}, nil
 	}
 
-	ip := &layers.IPv4{
-		Version:  4,
-		TTL:      64,
-		SrcIP:    s.InterfaceAddress.IP,
-		DstIP:    dst,
-		Protocol: layers.IPProtocolTCP,
-		Flags:    layers.IPv4DontFragment,
+	return &layers.Ethernet{
+		SrcMAC:       s.Device.HardwareAddr,
+		DstMAC:       s.GatewayMAC6,
+		EthernetType: layers.EthernetTypeIPv6,
+	}, &layers.IPv6{
+		Version:    6,
+		HopLimit:   64,
+		SrcIP:      s.InterfaceAddress6.IP,
+		DstIP:      dst,
+		NextHeader: layers.IPProtocolTCP,
+	}, nil
+}
+
+func (s *Scanner) buildSYNPacket(dst net.IP, dstPort uint16) ([]byte, layers.TCPPort, error) {
+	buffer := gopacket.NewSerializeBuffer()
+
+	ether, ip, err := s.networkLayers(dst)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	tcp := &layers.TCP{
@@ -277,19 +391,9 @@ func (s *Scanner) sendRSTPacket(pkt []byte) error {
 func (s *Scanner) buildRawRSTPacket(rst RSTSettings) ([]byte, error) {
 	buffer := gopacket.NewSerializeBuffer()
 
-	ether := &layers.Ethernet{
-		SrcMAC:       s.Device.HardwareAddr,
-		DstMAC:       s.GatewayMAC,
-		EthernetType: layers.EthernetTypeIPv4,
-	}
-
-	ip := &layers.IPv4{
-		Version:  4,
-		TTL:      64,
-		SrcIP:    s.InterfaceAddress.IP,
-		DstIP:    rst.DstIP,
-		Protocol: layers.IPProtocolTCP,
-		Flags:    layers.IPv4DontFragment,
+	ether, ip, err := s.networkLayers(rst.DstIP)
+	if err != nil {
+		return nil, err
 	}
 
 	tcp := &layers.TCP{
@@ -3,11 +3,20 @@ package net
 import (
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/mdlayher/arp"
 )
 
+// All-routers multicast address and its ethernet address
+var (
+	allRouters    = net.ParseIP("ff02::2")
+	allRoutersMAC = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x02}
+)
+
 func getInterface(ifaceName string) (*pcap.Interface, error) {
 	devs, err := pcap.FindAllDevs()
 	if err != nil {
@@ -43,6 +52,24 @@ func getInterfaceAddress(iface *pcap.Interface) *pcap.InterfaceAddress {
 	return nil
 }
 
+// getInterfaceAddress6 returns a global IPv6 address of the interface, and its link-local
+// address if it has one.
+func getInterfaceAddress6(iface *pcap.Interface) (global *pcap.InterfaceAddress, linkLocal net.IP) {
+	for i, addr := range iface.Addresses {
+		if addr.IP.To4() != nil || addr.IP.To16() == nil {
+			continue
+		}
+
+		if addr.IP.IsLinkLocalUnicast() {
+			linkLocal = addr.IP
+		} else if global == nil && addr.IP.IsGlobalUnicast() {
+			global = &iface.Addresses[i]
+		}
+	}
+
+	return global, linkLocal
+}
+
 func getGatewayMAC(iface *pcap.InterfaceAddress, dev *net.Interface) (net.HardwareAddr, error) {
 	cl, err := arp.Dial(dev)
 	if err != nil {
@@ -60,3 +87,114 @@ func getGatewayMAC(iface *pcap.InterfaceAddress, dev *net.Interface) (net.Hardwa
 
 	return dstMAC, nil
 }
+
+// getGatewayMAC6 finds the IPv6 default gateway with NDP, by sending a router solicitation
+// and waiting for an advertisement.
+func getGatewayMAC6(linkLocal net.IP, dev *net.Interface) (net.HardwareAddr, error) {
+	handle, err := pcap.OpenLive(dev.Name, 65535, false, 100*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	// Router advertisements, the type follows the fixed IPv6 header
+	if err := handle.SetBPFFilter("icmp6 and ip6[40] == 134"); err != nil {
+		return nil, err
+	}
+
+	pkt, err := buildRouterSolicitation(linkLocal, dev.HardwareAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := handle.WritePacketData(pkt); err != nil {
+		return nil, err
+	}
+
+	var (
+		eth     layers.Ethernet
+		ip6     layers.IPv6
+		icmp6   layers.ICMPv6
+		advert  layers.ICMPv6RouterAdvertisement
+		decoded = []gopacket.LayerType{}
+	)
+
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &eth, &ip6, &icmp6, &advert)
+	parser.IgnoreUnsupported = true
+
+	packets := gopacket.NewPacketSource(handle, handle.LinkType()).Packets()
+	timeout := time.After(3 * time.Second)
+	for {
+		var packet gopacket.Packet
+		select {
+		case packet = <-packets:
+		case <-timeout:
+			return nil, fmt.Errorf("no IPv6 router found on %s", dev.Name)
+		}
+
+		// Closed on read errors
+		if packet == nil {
+			return nil, fmt.Errorf("no IPv6 router found on %s", dev.Name)
+		}
+
+		if err := parser.DecodeLayers(packet.Data(), &decoded); err != nil {
+			continue
+		}
+
+		for _, t := range decoded {
+			// Routers with a lifetime of 0 aren't default routers
+			if t != layers.LayerTypeICMPv6RouterAdvertisement || advert.RouterLifetime == 0 {
+				continue
+			}
+
+			for _, opt := range advert.Options {
+				if opt.Type == layers.ICMPv6OptSourceAddress && len(opt.Data) == 6 {
+					return net.HardwareAddr(opt.Data), nil
+				}
+			}
+
+			return eth.SrcMAC, nil
+		}
+	}
+}
+
+// buildRouterSolicitation builds a router solicitation to all routers. Without a link-local
+// address it's sent from the unspecified address, without our link-layer address.
+func buildRouterSolicitation(linkLocal net.IP, mac net.HardwareAddr) ([]byte, error) {
+	buffer := gopacket.NewSerializeBuffer()
+
+	ether := &layers.Ethernet{
+		SrcMAC:       mac,
+		DstMAC:       allRoutersMAC,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+
+	ip := &layers.IPv6{
+		Version: 6,
+		// Required by NDP
+		HopLimit:   255,
+		SrcIP:      net.IPv6unspecified,
+		DstIP:      allRouters,
+		NextHeader: layers.IPProtocolICMPv6,
+	}
+
+	solicit := &layers.ICMPv6RouterSolicitation{}
+	if linkLocal != nil {
+		ip.SrcIP = linkLocal
+		solicit.Options = layers.ICMPv6Options{{Type: layers.ICMPv6OptSourceAddress, Data: mac}}
+	}
+
+	icmp := &layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeRouterSolicitation, 0),
+	}
+
+	if err := icmp.SetNetworkLayerForChecksum(ip); err != nil {
+		return nil, err
+	}
+
+	err := gopacket.SerializeLayers(buffer,
+		gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ether, ip, icmp, solicit)
+
+	return buffer.Bytes(), err
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/netbound/e7mon/config"
+)
+
+type Level int
+
+const (
+	Info Level = iota
+	Warning
+	Critical
+)
+
+func (l Level) String() string {
+	switch l {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseLevel parses the level names used in the config.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return Info, nil
+	case "warning", "warn":
+		return Warning, nil
+	case "critical", "crit":
+		return Critical, nil
+	default:
+		return 0, fmt.Errorf("unknown alert level '%s'", s)
+	}
+}
+
+// Alert is a single message sent out by one of the monitors.
+type Alert struct {
+	Level   Level
+	Source  string
+	Message string
+	Time    time.Time
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("[%s] %s: %s", strings.ToUpper(a.Level.String()), a.Source, a.Message)
+}
+
+// Notifier is implemented by all the messaging backends.
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// Dispatcher routes alerts to the notifiers configured for their level.
+type Dispatcher struct {
+	routes map[Level][]Notifier
+}
+
+// New builds the notifiers from the config. An empty (or nil) config results in a
+// Dispatcher that drops every alert.
+func New(cfg *config.AlertsConfig) (*Dispatcher, error) {
+	d := &Dispatcher{
+		routes: make(map[Level][]Notifier),
+	}
+
+	if cfg == nil {
+		return d, nil
+	}
+
+	channels := make(map[string]Notifier)
+	for _, ch := range cfg.Channels {
+		n, err := newNotifier(ch)
+		if err != nil {
+			return nil, err
+		}
+
+		channels[ch.ID] = n
+	}
+
+	for lvl, ids := range cfg.Routes {
+		l, err := ParseLevel(lvl)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			n, ok := channels[id]
+			if !ok {
+				return nil, fmt.Errorf("alert channel '%s' does not exist", id)
+			}
+
+			d.routes[l] = append(d.routes[l], n)
+		}
+	}
+
+	return d, nil
+}
+
+func newNotifier(ch config.Channel) (Notifier, error) {
+	switch ch.Type {
+	case "webhook":
+		return NewWebhook(ch.URL), nil
+	case "slack":
+		return NewSlack(ch.URL), nil
+	case "discord":
+		return NewDiscord(ch.URL), nil
+	case "telegram":
+		return NewTelegram(ch.URL, ch.Token, ch.ChatID), nil
+	case "smtp":
+		return NewSMTP(ch.Host, ch.Username, ch.Password, ch.From, ch.To), nil
+	default:
+		return nil, fmt.Errorf("channel '%s': unknown type '%s'", ch.ID, ch.Type)
+	}
+}
+
+// Notify sends the alert to every channel routed to its level. All channels are tried,
+// the errors are combined.
+func (d *Dispatcher) Notify(alert Alert) error {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+
+	var errs []string
+	for _, n := range d.routes[alert.Level] {
+		if err := n.Notify(alert); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("sending alert: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
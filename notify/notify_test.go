@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/netbound/e7mon/config"
+)
+
+func TestDispatcherRoutes(t *testing.T) {
+	received := make(chan webhookPayload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Error(err)
+		}
+		received <- p
+	}))
+	defer srv.Close()
+
+	d, err := New(&config.AlertsConfig{
+		Channels: []config.Channel{{ID: "hook", Type: "webhook", URL: srv.URL}},
+		Routes:   map[string][]string{"critical": {"hook"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not routed
+	if err := d.Notify(Alert{Level: Warning, Source: "TEST", Message: "dropped"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Notify(Alert{Level: Critical, Source: "TEST", Message: "2m0s since last block"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := <-received
+	if p.Level != "critical" || p.Message != "2m0s since last block" {
+		t.Errorf("unexpected payload: %+v", p)
+	}
+
+	select {
+	case p := <-received:
+		t.Errorf("unexpected alert: %+v", p)
+	default:
+	}
+}
+
+func TestUnknownChannel(t *testing.T) {
+	_, err := New(&config.AlertsConfig{
+		Routes: map[string][]string{"warning": {"missing"}},
+	})
+	if err == nil {
+		t.Error("expected error for unknown channel")
+	}
+}
+
+func TestErrorsHideSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	tg := NewTelegram(srv.URL, "123:secret", "1")
+	err := tg.Notify(Alert{Level: Critical, Message: "test"})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected an error without the token, got %v", err)
+	}
+
+	// Connection errors
+	srv.Close()
+	err = tg.Notify(Alert{Level: Critical, Message: "test"})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected an error without the token, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP sends alerts as plain text emails.
+type SMTP struct {
+	// Host in the format of "host:port"
+	Host     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func NewSMTP(host, username, password, from string, to []string) *SMTP {
+	return &SMTP{
+		Host:     host,
+		Username: username,
+		Password: password,
+		From:     from,
+		To:       to,
+	}
+}
+
+func (s *SMTP) Notify(alert Alert) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		hostname, _, err := net.SplitHostPort(s.Host)
+		if err != nil {
+			return err
+		}
+
+		auth = smtp.PlainAuth("", s.Username, s.Password, hostname)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: e7mon %s alert from %s\r\nDate: %s\r\n\r\n%s\r\n",
+		s.From,
+		strings.Join(s.To, ", "),
+		alert.Level,
+		alert.Source,
+		alert.Time.Format(time.RFC1123Z),
+		alert.String(),
+	)
+
+	return smtp.SendMail(s.Host, auth, s.From, s.To, []byte(msg))
+}
@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+// Telegram sends messages through the Telegram bot API.
+type Telegram struct {
+	API    string
+	Token  string
+	ChatID string
+}
+
+// NewTelegram returns a Telegram notifier. If api is empty, the public bot API is used.
+func NewTelegram(api, token, chatID string) *Telegram {
+	if api == "" {
+		api = telegramAPI
+	}
+
+	return &Telegram{
+		API:    strings.TrimSuffix(api, "/"),
+		Token:  token,
+		ChatID: chatID,
+	}
+}
+
+func (t *Telegram) Notify(alert Alert) error {
+	return postJSON("telegram", fmt.Sprintf("%s/bot%s/sendMessage", t.API, t.Token), map[string]string{
+		"chat_id": t.ChatID,
+		"text":    alert.String(),
+	})
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON posts v to the URL of a channel. Webhook URLs and bot tokens are secrets, so
+// errors only contain the channel and the host.
+func postJSON(channel, rawURL string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	host := "unknown host"
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+
+	res, err := client.Post(rawURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: POST to %s: %w", channel, host, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s: POST to %s: unexpected status %s", channel, host, res.Status)
+	}
+
+	return nil
+}
+
+// Webhook posts the alert as JSON to a generic HTTP endpoint.
+type Webhook struct {
+	URL string
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url}
+}
+
+type webhookPayload struct {
+	Level   string    `json:"level"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+func (w *Webhook) Notify(alert Alert) error {
+	return postJSON("webhook", w.URL, webhookPayload{
+		Level:   alert.Level.String(),
+		Source:  alert.Source,
+		Message: alert.Message,
+		Time:    alert.Time,
+	})
+}
+
+// Slack posts to a Slack incoming webhook.
+type Slack struct {
+	URL string
+}
+
+func NewSlack(url string) *Slack {
+	return &Slack{URL: url}
+}
+
+func (s *Slack) Notify(alert Alert) error {
+	return postJSON("slack", s.URL, map[string]string{"text": alert.String()})
+}
+
+// Discord posts to a Discord incoming webhook.
+type Discord struct {
+	URL string
+}
+
+func NewDiscord(url string) *Discord {
+	return &Discord{URL: url}
+}
+
+func (d *Discord) Notify(alert Alert) error {
+	return postJSON("discord", d.URL, map[string]string{"content": alert.String()})
+}